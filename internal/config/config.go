@@ -8,14 +8,56 @@ import (
 )
 
 type Config struct {
-	Server       Server         `yaml:"server"`
-	Minio        Minio          `yaml:"minio"`
-	Git          Git            `yaml:"git"`
-	ExposedPaths []ExposedPath  `yaml:"exposedPaths"`
-	Logs         LogConfig      `yaml:"logs"`
-	Cache        CacheConfig    `yaml:"cache"`        // 新增缓存配置
-	Buckets      []BucketConfig `yaml:"buckets"`      // 新增多桶配置
-	ExternalURLs []ExternalURL  `yaml:"externalURLs"` // 新增外部URL配置
+	Server       Server            `yaml:"server"`
+	Minio        Minio             `yaml:"minio"`
+	Storage      StorageConfig     `yaml:"storage"` // 新增存储后端配置
+	Git          Git               `yaml:"git"`
+	ExposedPaths []ExposedPath     `yaml:"exposedPaths"`
+	Logs         LogConfig         `yaml:"logs"`
+	Cache        CacheConfig       `yaml:"cache"`        // 新增缓存配置
+	Buckets      []BucketConfig    `yaml:"buckets"`      // 新增多桶配置
+	ExternalURLs []ExternalURL     `yaml:"externalURLs"` // 新增外部URL配置
+	Auth         AuthConfig        `yaml:"auth"`         // 新增API认证配置
+	ContentTypes map[string]string `yaml:"contentTypes"` // 新增：按扩展名覆盖 Content-Type，如 {".ts": "video/mp2t"}
+	Sites        []Site            `yaml:"sites"`        // 新增：按域名区分的站点
+}
+
+// 按请求域名（Host 或可信反向代理设置的 X-Forwarded-Host）匹配的站点，站点的根路径对应一个存储位置
+// 根目录三选一：exposedPath，或者 bucket 与 minioPath 组合（仓库使用其 minioPath）
+type Site struct {
+	Hosts        []string       `yaml:"hosts"`        // 域名，支持 "*.example.com" 通配，"*" 匹配其他所有域名；精确匹配优先，其次为最长的通配
+	MinioPath    string         `yaml:"minioPath"`    // 站点根目录在存储中的前缀，如仓库的 minioPath
+	Bucket       string         `yaml:"bucket"`       // 站点根目录所在的存储桶（buckets 中的 name），为空时为默认存储
+	ExposedPath  string         `yaml:"exposedPath"`  // 使用暴露路径、仓库或存储桶的访问路径作为站点根目录，如 "/docs"，设置后忽略 minioPath 和 bucket
+	Index        []string       `yaml:"index"`        // 目录索引文件，为空时使用根目录对应的仓库或存储桶的配置
+	Listing      bool           `yaml:"listing"`      // 目录下没有索引文件时显示文件列表
+	Fallback     string         `yaml:"fallback"`     // 单页应用入口文件，相对于站点根目录
+	ErrorPages   map[int]string `yaml:"errorPages"`   // 自定义错误页面，相对于站点根目录
+	CacheControl string         `yaml:"cacheControl"` // 浏览器和 CDN 缓存时间，如 "1h"，"no-cache" 或 "no-store" 同时跳过服务端缓存；为空时使用 cache.cacheControl
+	AllowOrigins []string       `yaml:"allowOrigins"` // CORS 允许的域名，为空时使用 server.allowOrigins
+}
+
+// 新增：存储后端配置
+type StorageConfig struct {
+	Driver string `yaml:"driver"` // 存储驱动: minio(默认)/local/memory
+	Path   string `yaml:"path"`   // local 驱动的根目录，默认 data
+}
+
+// 新增：API认证配置
+type AuthConfig struct {
+	Enabled         bool     `yaml:"enabled"`         // 是否启用API认证
+	AnonymousScopes []string `yaml:"anonymousScopes"` // 未携带密钥时拥有的权限，如 ["read"]
+	Keys            []APIKey `yaml:"keys"`            // API密钥列表
+	AdminToken      string   `yaml:"adminToken"`      // 新增：未启用认证时同步管理接口（手动同步、取消等）使用的令牌，为空时拒绝访问
+}
+
+// API密钥配置
+type APIKey struct {
+	Name     string   `yaml:"name"`     // 密钥名称，仅用于日志
+	Key      string   `yaml:"key"`      // 密钥内容
+	Scopes   []string `yaml:"scopes"`   // 权限范围: read/list/write/admin
+	Prefixes []string `yaml:"prefixes"` // 允许访问的路径前缀，与 buckets 均为空表示不限制
+	Buckets  []string `yaml:"buckets"`  // 允许访问的存储桶
 }
 
 // 新增：日志配置结构
@@ -53,6 +95,16 @@ type BucketConfig struct {
 	BucketName string `yaml:"bucketName"`
 	BasePath   string `yaml:"basePath"` // 基础路径
 	ReadOnly   bool   `yaml:"readOnly"` // 是否只读
+
+	// 写入接口配置（仅非只读桶生效）
+	WriteToken    string   `yaml:"writeToken"`    // 写入令牌，通过 Authorization: Bearer 传入
+	MaxUploadSize int      `yaml:"maxUploadSize"` // 单次上传请求大小上限(MB)，0 表示不限制
+	AllowedTypes  []string `yaml:"allowedTypes"`  // 允许上传的 Content-Type，支持 image/* 形式，为空表示不限制
+
+	Index   []string `yaml:"index"`   // 新增：目录索引文件，按顺序尝试，默认 ["index.html"]，设置为 [] 关闭
+	Listing bool     `yaml:"listing"` // 新增：目录下没有索引文件时显示文件列表
+
+	URLPolicy URLPolicy `yaml:"urlPolicy"` // 新增：直接访问地址策略，未设置 mode 时由服务代理
 }
 
 // 添加新的配置结构
@@ -66,41 +118,110 @@ type ExternalURL struct {
 }
 
 type Server struct {
-	Port         int      `yaml:"port"`
-	Host         string   `yaml:"host"`
-	EnableAPI    bool     `yaml:"enableAPI"`    // 新增：是否启用 API
-	APIOnly      bool     `yaml:"apiOnly"`      // 新增：仅启用 API
-	LegacyAPI    bool     `yaml:"legacyAPI"`    // 是否支持旧版API格式
-	AllowOrigins []string `yaml:"allowOrigins"` // 新增: CORS 允许的域名列表
+	Port           int            `yaml:"port"`
+	Host           string         `yaml:"host"`
+	EnableAPI      bool           `yaml:"enableAPI"`      // 新增：是否启用 API
+	APIOnly        bool           `yaml:"apiOnly"`        // 新增：仅启用 API
+	LegacyAPI      bool           `yaml:"legacyAPI"`      // 是否支持旧版API格式
+	AllowOrigins   []string       `yaml:"allowOrigins"`   // 新增: CORS 允许的域名列表
+	ErrorPages     map[int]string `yaml:"errorPages"`     // 新增：默认的错误页面，默认存储中的对象路径，如 {404: "static/404.html"}
+	TrustedProxies []string       `yaml:"trustedProxies"` // 新增：可信的反向代理地址（IP 或 CIDR），只有来自这些地址的请求才使用 X-Forwarded-Host
 }
 
 type Minio struct {
-	Endpoint     string `yaml:"endpoint"`
-	AccessKey    string `yaml:"accessKey"`
-	SecretKey    string `yaml:"secretKey"`
-	UseSSL       bool   `yaml:"useSSL"`
-	Bucket       string `yaml:"bucket"`
-	UsePublicURL bool   `yaml:"usePublicURL"`
-	MaxWorkers   int    `yaml:"maxWorkers"` // 新增：最大并发上传线程数
+	Endpoint     string    `yaml:"endpoint"`
+	AccessKey    string    `yaml:"accessKey"`
+	SecretKey    string    `yaml:"secretKey"`
+	UseSSL       bool      `yaml:"useSSL"`
+	Bucket       string    `yaml:"bucket"`
+	UsePublicURL bool      `yaml:"usePublicURL"`
+	MaxWorkers   int       `yaml:"maxWorkers"` // 新增：最大并发上传线程数
+	URLPolicy    URLPolicy `yaml:"urlPolicy"`  // 新增：默认存储的直接访问地址策略，需要启用 usePublicURL
+}
+
+// 新增：直接访问地址（文件访问的跳转和文件列表中的 url）的生成方式
+// 仓库和存储桶中的设置逐项覆盖 minio.urlPolicy
+type URLPolicy struct {
+	Mode               string `yaml:"mode"`               // presign：预签名URL（默认）；public：不带签名的公开地址；proxy：始终由服务代理
+	Expiry             string `yaml:"expiry"`             // 预签名URL的有效期，默认 "1h"，最长 "7d"
+	BaseURL            string `yaml:"baseURL"`            // public 模式的地址前缀，如 CDN 域名，对应存储桶（含 basePath）的根目录；为空时使用 endpoint
+	ContentDisposition string `yaml:"contentDisposition"` // 预签名URL返回的 Content-Disposition，"attachment" 或 "inline" 时附加文件名
+	CacheControl       string `yaml:"cacheControl"`       // 预签名URL返回的 Cache-Control，时间间隔转换为 max-age
 }
 
 type Git struct {
 	CachePath    string       `yaml:"cachePath"`
+	Jitter       string       `yaml:"jitter"`    // 新增：定时同步随机延迟上限，默认为检查间隔的10%（最多5分钟）
+	StateFile    string       `yaml:"stateFile"` // 新增：同步状态文件，默认 .cache/sync-state.json
 	Repositories []Repository `yaml:"repositories"`
 }
 
 type Repository struct {
-	URL           string `yaml:"url"`
-	Branch        string `yaml:"branch"`
-	LocalPath     string `yaml:"localPath"`
-	MinioPath     string `yaml:"minioPath"`
-	DisabledSync  bool   `yaml:"disabledSync"`  // 新增：是否禁用同步
-	CheckInterval string `yaml:"checkInterval"` // 新增：仓库检查间隔
+	URL              string            `yaml:"url"`
+	Branch           string            `yaml:"branch"`
+	LocalPath        string            `yaml:"localPath"`
+	MinioPath        string            `yaml:"minioPath"`
+	DisabledSync     bool              `yaml:"disabledSync"`     // 新增：是否禁用同步
+	CheckInterval    string            `yaml:"checkInterval"`    // 新增：仓库检查间隔
+	CheckSchedule    string            `yaml:"checkSchedule"`    // 新增：cron 表达式，如 "0 */2 * * *"，设置后优先于 checkInterval
+	WebhookSecret    string            `yaml:"webhookSecret"`    // 新增：推送 Webhook 签名密钥
+	KeepVersions     int               `yaml:"keepVersions"`     // 新增：保留的版本数，默认 10，-1 表示不记录版本
+	AtomicPublish    bool              `yaml:"atomicPublish"`    // 新增：先上传到新的 release 目录再整体切换，读者不会看到新旧文件混杂
+	MaxDeletions     int               `yaml:"maxDeletions"`     // 新增：单次同步最多删除的文件数，超过时中止等待确认，0 表示不限制
+	MaxDeletePercent float64           `yaml:"maxDeletePercent"` // 新增：单次同步最多删除已发布文件的百分比，0 表示不限制比例，但仍不允许同步后没有任何文件，设置为 100 时允许
+	Auth             *GitAuth          `yaml:"auth"`             // 新增：私有仓库认证
+	Tag              string            `yaml:"tag"`              // 新增：固定到标签，优先于 branch
+	Commit           string            `yaml:"commit"`           // 新增：固定到提交 SHA，优先于 tag 和 branch
+	SubPath          string            `yaml:"subPath"`          // 新增：只发布仓库中的子目录，如 "docs/build"
+	SparseCheckout   bool              `yaml:"sparseCheckout"`   // 新增：只检出 subPath，减少本地磁盘占用
+	Include          []string          `yaml:"include"`          // 新增：只发布匹配的文件（glob，相对于 subPath），为空表示全部
+	Exclude          []string          `yaml:"exclude"`          // 新增：不发布匹配的文件，仓库中的 .filesapiignore 追加排除规则
+	LFS              bool              `yaml:"lfs"`              // 新增：拉取 Git LFS 对象，需要安装 git-lfs
+	Submodules       bool              `yaml:"submodules"`       // 新增：递归初始化并浅拉取子模块
+	Build            *Build            `yaml:"build"`            // 新增：发布前执行的构建步骤
+	Source           string            `yaml:"source"`           // 新增：同步来源 git（默认）、archive（url 为压缩包地址）、s3（url 为 s3://存储桶/前缀）
+	StripComponents  int               `yaml:"stripComponents"`  // 新增：archive 解压时去掉的目录层级，如 GitHub 源码包为 1
+	S3               *S3Source         `yaml:"s3"`               // 新增：s3 来源的连接配置，未设置时使用 minio 的连接配置
+	ContentTypes     map[string]string `yaml:"contentTypes"`     // 新增：按扩展名覆盖 Content-Type，优先于全局配置，如 {".ts": "video/mp2t"}
+	Index            []string          `yaml:"index"`            // 新增：目录索引文件，按顺序尝试，默认 ["index.html"]，设置为 [] 关闭
+	Listing          bool              `yaml:"listing"`          // 新增：目录下没有索引文件时显示文件列表
+	URLPolicy        URLPolicy         `yaml:"urlPolicy"`        // 新增：直接访问地址策略，逐项覆盖 minio.urlPolicy
+}
+
+// s3 来源的连接配置，accessKey 和 secretKey 支持 "env:变量名" 和 "file:路径"
+type S3Source struct {
+	Endpoint  string `yaml:"endpoint"`
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+	UseSSL    bool   `yaml:"useSSL"`
+	Region    string `yaml:"region"`
+}
+
+// 发布前的构建步骤，命令通过 shell 执行，失败或超时时不发布
+type Build struct {
+	Command string            `yaml:"command"` // 构建命令，如 "hugo --minify"
+	WorkDir string            `yaml:"workDir"` // 工作目录，相对于仓库根目录，默认为仓库根目录
+	Env     map[string]string `yaml:"env"`     // 额外的环境变量
+	Timeout string            `yaml:"timeout"` // 超时时间，默认 10m
+	Output  string            `yaml:"output"`  // 输出目录，相对于仓库根目录，设置后代替 subPath 作为发布内容，构建前会被清空
+}
+
+// 私有仓库认证，设置 sshKey 时使用 SSH，否则使用 HTTPS 令牌或用户名密码
+// token、password、sshKey、knownHosts 支持 "env:变量名" 和 "file:路径" 从环境变量或文件读取
+type GitAuth struct {
+	Username   string `yaml:"username"`   // HTTPS 用户名，使用 token 时默认为 x-access-token
+	Password   string `yaml:"password"`   // HTTPS 密码
+	Token      string `yaml:"token"`      // HTTPS 访问令牌，优先于 password
+	SSHKey     string `yaml:"sshKey"`     // SSH 私钥内容，需要无密码短语
+	KnownHosts string `yaml:"knownHosts"` // SSH known_hosts 内容，未设置时使用系统默认的 known_hosts
 }
 
 type ExposedPath struct {
-	URLPath   string `yaml:"urlPath"`
-	MinioPath string `yaml:"minioPath"`
+	URLPath    string         `yaml:"urlPath"`    // 访问路径前缀，可以是多级路径，如 "/docs/v2"，"/" 表示根路径
+	MinioPath  string         `yaml:"minioPath"`  // 存储中的路径前缀，可以是多级路径，为空表示整个存储桶
+	Bucket     string         `yaml:"bucket"`     // 新增：存储桶名称（buckets 中的 name），为空时为默认存储
+	Fallback   string         `yaml:"fallback"`   // 新增：单页应用入口文件，相对于 minioPath，文件不存在时返回该文件，如 "index.html"
+	ErrorPages map[int]string `yaml:"errorPages"` // 新增：自定义错误页面，相对于 minioPath，如 {404: "404.html"}
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -146,6 +267,10 @@ func createDefaultConfig(path string) error {
 			UsePublicURL: true,
 			MaxWorkers:   16, // 默认16个线程
 		},
+		Storage: StorageConfig{
+			Driver: "minio", // 默认使用 Minio
+			Path:   "data",  // local 驱动的根目录
+		},
 		Git: Git{
 			CachePath: ".cache/repos",
 			Repositories: []Repository{
@@ -186,6 +311,7 @@ func createDefaultConfig(path string) error {
 			APICacheControl: "5m",  // API默认缓存5分钟
 			APIExcludePaths: []string{
 				"/api/files/sync/status", // 默认不缓存同步状态接口
+				"/api/files/sync/events", // 同步事件流
 			},
 		},
 		Buckets: []BucketConfig{
@@ -210,6 +336,17 @@ func createDefaultConfig(path string) error {
 				CheckInterval: "1h",
 			},
 		},
+		Auth: AuthConfig{
+			Enabled:         false, // 默认不启用API认证
+			AnonymousScopes: []string{"read", "list"},
+			Keys: []APIKey{
+				{
+					Name:   "admin",
+					Key:    "change-me",
+					Scopes: []string{"admin"},
+				},
+			},
+		},
 	}
 
 	data, err := yaml.Marshal(&defaultConfig)
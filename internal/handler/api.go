@@ -2,26 +2,33 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"os"
 	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	"pysio.online/Files-API/internal/config"
+	"pysio.online/Files-API/internal/middleware"
 	"pysio.online/Files-API/internal/service"
 )
 
 type APIHandler struct {
-	minioService *service.MinioService
-	config       *config.Config
+	storage     service.Storage
+	syncManager *service.SyncManager
+	config      *config.Config
+	mounts      mountTable
 }
 
-func NewAPIHandler(minioService *service.MinioService, config *config.Config) *APIHandler {
+func NewAPIHandler(storage service.Storage, syncManager *service.SyncManager, config *config.Config) *APIHandler {
 	return &APIHandler{
-		minioService: minioService,
-		config:       config,
+		storage:     storage,
+		syncManager: syncManager,
+		config:      config,
+		mounts:      newMountTable(config),
 	}
 }
 
@@ -57,6 +64,14 @@ type SyncStatusResponse struct {
 	Data    map[string]*service.SyncStatus `json:"data"`
 }
 
+// BucketOf 返回列表路径（/api/files/ 之后的部分）按挂载表对应的存储桶名称，默认存储返回空字符串
+func (h *APIHandler) BucketOf(prefix string) string {
+	if m, _ := h.mounts.match("/" + prefix); m != nil {
+		return m.opts.bucket
+	}
+	return ""
+}
+
 func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// 设置 JSON 响应头
 	w.Header().Set("Content-Type", "application/json")
@@ -74,6 +89,18 @@ func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.handleSyncStatus(w, r)
 		return
 	}
+	if prefix == "sync/events" {
+		h.handleSyncEvents(w, r)
+		return
+	}
+	if prefix == "sync/webhook" {
+		h.handleSyncWebhook(w, r)
+		return
+	}
+	if minioPath, action, ok := parseSyncAction(prefix); ok {
+		h.handleSyncAction(w, r, minioPath, action)
+		return
+	}
 
 	// 处理 PATCH 请求
 	if r.Method == http.MethodPatch {
@@ -81,6 +108,13 @@ func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 处理写入请求
+	switch r.Method {
+	case http.MethodPut, http.MethodPost, http.MethodDelete:
+		h.handleWriteRequest(w, r, prefix)
+		return
+	}
+
 	// 分页参数
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
 	pageSize, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
@@ -91,56 +125,27 @@ func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		pageSize = 20
 	}
 
+	// 按挂载表转换为存储桶和对象前缀，未匹配时直接列出默认存储
+	bucket, listPrefix := "", prefix
+	opts := newServeOptions(h.config, "", nil, false, config.URLPolicy{})
+	m, rest := h.mounts.match("/" + prefix)
+	if m != nil {
+		if rest == "" {
+			rest = "/"
+		}
+		bucket, listPrefix, opts = m.opts.bucket, m.key(rest), m.opts
+	}
+
 	// 获取文件列表
-	objects, err := h.minioService.ListObjects(prefix)
+	objects, err := h.storage.List(r.Context(), bucket, listPrefix)
 	if err != nil {
+		log.Printf("获取文件列表失败 %s: %v", listPrefix, err)
 		h.responseError(w, http.StatusInternalServerError, "获取文件列表失败")
 		return
 	}
 
 	// 构建文件列表
-	var files []FileInfo
-	seenDirs := make(map[string]bool)
-
-	for _, obj := range objects {
-		// 跳过当前目录
-		if obj.Key == prefix {
-			continue
-		}
-
-		// 相对于当前目录的路径
-		relPath := strings.TrimPrefix(obj.Key, prefix)
-		parts := strings.Split(relPath, "/")
-
-		if len(parts) > 1 {
-			// 这是子目录中的文件，添加目录条目
-			dirName := parts[0]
-			dirPath := path.Join(prefix, dirName) + "/"
-			if !seenDirs[dirPath] {
-				files = append(files, FileInfo{
-					Name:        dirName,
-					Path:        dirPath,
-					IsDirectory: true,
-				})
-				seenDirs[dirPath] = true
-			}
-		} else {
-			// 这是文件
-			fileURL := ""
-			if h.config.Minio.UsePublicURL {
-				fileURL = h.minioService.GetPublicURL(obj.Key)
-			}
-
-			files = append(files, FileInfo{
-				Name:         path.Base(obj.Key),
-				Path:         obj.Key,
-				Size:         obj.Size,
-				LastModified: obj.LastModified,
-				IsDirectory:  false,
-				URL:          fileURL,
-			})
-		}
-	}
+	files := listEntries(objects, listPrefix)
 
 	// 计算分页
 	total := len(files)
@@ -155,6 +160,17 @@ func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		files = files[start:end]
 	}
 
+	for i := range files {
+		// 仅为当前页的文件生成访问URL，预签名URL在有效期内重复使用
+		if opts.direct() && !files[i].IsDirectory {
+			files[i].URL, _ = objectURL(r.Context(), h.storage, files[i].Path, opts)
+		}
+		// 返回挂载后的访问路径
+		if m != nil {
+			files[i].Path = m.urlKey(files[i].Path)
+		}
+	}
+
 	// 返回响应
 	h.responseSuccess(w, files, &Pagination{
 		Current:  page,
@@ -173,7 +189,10 @@ func (h *APIHandler) handleSyncStatus(w http.ResponseWriter, r *http.Request) {
 	// 收集所有仓库的同步状态
 	statuses := make(map[string]*service.SyncStatus)
 	for _, repo := range h.config.Git.Repositories {
-		status := h.minioService.GetSyncStatus(repo.MinioPath)
+		if !repoVisible(r, repo.MinioPath) {
+			continue
+		}
+		status := h.syncManager.Status(repo.MinioPath)
 		statuses[repo.MinioPath] = status
 	}
 
@@ -187,6 +206,12 @@ func (h *APIHandler) handleSyncStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// 请求的密钥是否允许查看仓库的同步状态和事件，未启用认证时全部可见
+func repoVisible(r *http.Request, minioPath string) bool {
+	key, ok := middleware.AuthKeyFromContext(r.Context())
+	return !ok || key.AllowsRepo(minioPath)
+}
+
 // 新增 PATCH 请求结构
 type PatchRequest struct {
 	Bucket string `json:"bucket"`
@@ -220,17 +245,13 @@ func (h *APIHandler) handlePatchRequest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 获取对象
-	obj, err := h.minioService.GetObjectFromBucket(req.Bucket, req.Path)
-	if err != nil {
-		h.responseError(w, http.StatusNotFound, "文件不存在")
-		return
-	}
-	defer obj.Close()
-
 	// 获取文件信息并返回
-	info, err := obj.Stat()
+	info, err := h.storage.Stat(r.Context(), req.Bucket, req.Path)
 	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			h.responseError(w, http.StatusNotFound, "文件不存在")
+			return
+		}
 		h.responseError(w, http.StatusInternalServerError, "获取文件信息失败")
 		return
 	}
@@ -1,25 +1,110 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	"pysio.online/Files-API/internal/config"
+	"pysio.online/Files-API/internal/middleware"
 	"pysio.online/Files-API/internal/service"
 )
 
 type DocsHandler struct {
-	minioService *service.MinioService
-	config       *config.Config
+	storage service.Storage
+	config  *config.Config
+	mounts  mountTable
+	sites   map[*config.Site]*mount // 站点根路径的挂载点
 }
 
-func NewDocsHandler(minioService *service.MinioService, config *config.Config) *DocsHandler {
+func NewDocsHandler(storage service.Storage, config *config.Config) *DocsHandler {
+	mounts := newMountTable(config)
 	return &DocsHandler{
-		minioService: minioService,
-		config:       config,
+		storage: storage,
+		config:  config,
+		mounts:  mounts,
+		sites:   newSiteMounts(config, mounts),
+	}
+}
+
+// 路径的访问设置
+type serveOptions struct {
+	bucket     string           // 存储桶名称，为空时表示默认存储
+	root       string           // 挂载点根目录的对象键，该目录不显示上级链接
+	index      []string         // 依次尝试的索引文件
+	listing    bool             // 没有索引文件时显示目录列表
+	fallback   string           // 单页应用入口文件的对象键，文件不存在时返回
+	errorPages map[int]string   // 状态码对应的错误页面对象键
+	urlPolicy  config.URLPolicy // 直接访问地址策略，mode 为 proxy 时由服务代理
+}
+
+// 默认的访问设置，未配置索引文件时使用 index.html，配置为空列表时不解析索引
+func newServeOptions(cfg *config.Config, bucket string, index []string, listing bool, policy config.URLPolicy) serveOptions {
+	if index == nil {
+		index = []string{"index.html"}
+	}
+	opts := serveOptions{bucket: bucket, index: index, listing: listing, urlPolicy: resolveURLPolicy(cfg, bucket, policy)}
+	// 全局错误页面位于默认存储中
+	if bucket == "" {
+		opts.errorPages = cfg.Server.ErrorPages
+	}
+	return opts
+}
+
+// 直接访问地址策略：仓库或存储桶中设置的项覆盖 minio.urlPolicy；
+// 默认存储需要启用 usePublicURL，其他存储桶需要设置自己的 mode，否则由服务代理
+func resolveURLPolicy(cfg *config.Config, bucket string, override config.URLPolicy) config.URLPolicy {
+	policy := cfg.Minio.URLPolicy
+	if bucket == "" && !cfg.Minio.UsePublicURL || bucket != "" && override.Mode == "" {
+		policy.Mode = service.URLModeProxy
+	}
+	if override.Mode != "" {
+		policy.Mode = override.Mode
+	}
+	if override.Expiry != "" {
+		policy.Expiry = override.Expiry
+	}
+	if override.BaseURL != "" {
+		policy.BaseURL = override.BaseURL
+	}
+	if override.ContentDisposition != "" {
+		policy.ContentDisposition = override.ContentDisposition
+	}
+	if override.CacheControl != "" {
+		policy.CacheControl = override.CacheControl
+	}
+	return policy
+}
+
+// 是否使用直接访问地址而不是由服务代理
+func (opts serveOptions) direct() bool {
+	return opts.urlPolicy.Mode != service.URLModeProxy
+}
+
+// 应用暴露路径的单页应用和错误页面设置，路径相对于 minioPath
+func (opts *serveOptions) applyExposed(exposed *config.ExposedPath) {
+	if exposed.Fallback != "" {
+		opts.fallback = path.Join(exposed.MinioPath, exposed.Fallback)
+	}
+	if len(exposed.ErrorPages) > 0 {
+		pages := make(map[int]string, len(opts.errorPages)+len(exposed.ErrorPages))
+		for status, key := range opts.errorPages {
+			pages[status] = key
+		}
+		for status, page := range exposed.ErrorPages {
+			pages[status] = path.Join(exposed.MinioPath, page)
+		}
+		opts.errorPages = pages
 	}
 }
 
@@ -40,86 +125,174 @@ func (h *DocsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 移除前导斜杠
-	filePath := strings.TrimPrefix(r.URL.Path, "/")
-	if filePath == "" {
-		http.Error(w, "无效的访问路径", http.StatusBadRequest)
+	// 匹配站点时整个域名对应站点的根目录，否则按最长前缀匹配挂载点（存储桶、仓库和暴露路径）
+	var m *mount
+	rest := r.URL.Path
+	if site := middleware.SiteFromContext(r.Context()); site != nil {
+		m = h.sites[site]
+	}
+	if m == nil {
+		m, rest = h.mounts.match(r.URL.Path)
+	}
+	if m == nil {
+		opts := newServeOptions(h.config, "", nil, false, config.URLPolicy{})
+		if r.URL.Path == "/" {
+			h.responseError(w, r, opts, http.StatusBadRequest, "无效的访问路径")
+			return
+		}
+		h.responseError(w, r, opts, http.StatusForbidden, "未授权的访问路径")
 		return
 	}
 
-	// 获取第一级路径
-	parts := strings.SplitN(filePath, "/", 2)
-	basePath := parts[0]
-	remainingPath := ""
-	if len(parts) > 1 {
-		remainingPath = parts[1]
+	// 访问挂载点本身时跳转到带 / 的地址
+	if rest == "" && m.urlPath != "/" {
+		h.redirectDirectory(w, r, m.opts.root, m.opts)
+		return
 	}
+	h.serve(w, r, m.key(rest), m.opts)
+}
 
-	// 先检查是否匹配配置的桶
-	var matchedBucket *config.BucketConfig
-	for _, bucket := range h.config.Buckets {
-		if bucket.Name == basePath {
-			matchedBucket = &bucket
-			break
+// 输出存储中的对象，key 为空或以 / 结尾时按目录处理：依次查找索引文件，找不到时按配置显示目录列表；
+// 对象不存在但对应目录存在时跳转到带 / 的规范地址
+func (h *DocsHandler) serve(w http.ResponseWriter, r *http.Request, key string, opts serveOptions) {
+	ctx := r.Context()
+	if key == "" || strings.HasSuffix(key, "/") {
+		index, err := h.findIndex(ctx, key, opts)
+		if err != nil {
+			log.Printf("查找索引文件失败 %s: %v", key, err)
+			h.responseError(w, r, opts, http.StatusInternalServerError, "获取文件信息失败")
+			return
+		}
+		switch {
+		case index != "":
+			h.serveObject(w, r, index, opts)
+		case opts.listing:
+			h.serveListing(w, r, key, opts)
+		default:
+			h.notFound(w, r, key, opts)
 		}
+		return
 	}
 
-	if matchedBucket != nil {
-		// 处理匹配到的桶
-		obj, err := h.minioService.GetObjectFromBucket(matchedBucket.Name, remainingPath)
-		if err != nil {
-			http.Error(w, "文件不存在", http.StatusNotFound)
+	var err error
+	if opts.direct() {
+		// 使用直接访问地址时不读取对象，只有无扩展名的路径需要确认是否为目录
+		if path.Ext(key) != "" {
+			h.serveObject(w, r, key, opts)
 			return
 		}
-		defer obj.Close()
-
-		// 获取文件信息
-		info, err := obj.Stat()
-		if err != nil {
-			http.Error(w, "获取文件信息失败", http.StatusInternalServerError)
+		if _, err = h.storage.Stat(ctx, opts.bucket, key); err == nil {
+			h.serveObject(w, r, key, opts)
+			return
+		}
+	} else {
+		var object service.Object
+		if object, err = h.storage.Get(ctx, opts.bucket, key); err == nil {
+			defer object.Close()
+			// 输出文件内容（支持 Range 和条件请求）
+			middleware.ServeObject(w, r, key, object, object.Info())
 			return
 		}
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		log.Printf("获取文件失败 %s: %v", key, err)
+		h.responseError(w, r, opts, http.StatusInternalServerError, "获取文件信息失败")
+		return
+	}
 
-		// 设置响应头
-		w.Header().Set("Content-Type", info.ContentType)
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size))
+	h.redirectDirectory(w, r, key+"/", opts)
+}
 
-		// 输出文件内容
-		if _, err := io.Copy(w, obj); err != nil {
-			log.Printf("发送文件失败 %s: %v", remainingPath, err)
-		}
+// 目录存在时跳转到带 / 的规范地址，否则按文件不存在处理
+func (h *DocsHandler) redirectDirectory(w http.ResponseWriter, r *http.Request, dir string, opts serveOptions) {
+	isDir, err := h.isDirectory(r.Context(), dir, opts)
+	if err != nil {
+		log.Printf("查找索引文件失败 %s: %v", dir, err)
+		h.responseError(w, r, opts, http.StatusInternalServerError, "获取文件信息失败")
 		return
 	}
+	if !isDir {
+		h.notFound(w, r, strings.TrimSuffix(dir, "/"), opts)
+		return
+	}
+	target := r.URL.Path + "/"
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	if h.config.Logs.RedirectLog {
+		log.Printf("Redirect: %s -> %s", r.URL.Path, target)
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
 
-	// 如果不是配置的桶,则按原有逻辑处理
-	authorized := false
-	// 检查Git仓库配置
-	for _, repo := range h.config.Git.Repositories {
-		if repo.MinioPath == basePath {
-			authorized = true
-			break
+// 返回目录下第一个存在的索引文件，不存在时返回空字符串
+func (h *DocsHandler) findIndex(ctx context.Context, dir string, opts serveOptions) (string, error) {
+	for _, name := range opts.index {
+		key := dir + name
+		_, err := h.storage.Stat(ctx, opts.bucket, key)
+		if err == nil {
+			return key, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
 		}
 	}
+	return "", nil
+}
 
-	// 检查暴露路径配置
-	if !authorized {
-		for _, exposed := range h.config.ExposedPaths {
-			if exposed.MinioPath == basePath {
-				authorized = true
-				break
-			}
-		}
+// 目录是否存在：有索引文件，或者启用目录列表且目录不为空
+func (h *DocsHandler) isDirectory(ctx context.Context, dir string, opts serveOptions) (bool, error) {
+	index, err := h.findIndex(ctx, dir, opts)
+	if err != nil || index != "" || !opts.listing {
+		return index != "", err
 	}
+	objects, err := h.storage.List(ctx, opts.bucket, dir)
+	if err != nil {
+		return false, err
+	}
+	return len(listEntries(objects, dir)) > 0, nil
+}
 
-	if !authorized {
-		http.Error(w, "未授权的访问路径", http.StatusForbidden)
+// 输出目录列表，format=json 时返回与文件列表接口相同的 JSON 格式，否则返回 HTML 页面
+func (h *DocsHandler) serveListing(w http.ResponseWriter, r *http.Request, dir string, opts serveOptions) {
+	objects, err := h.storage.List(r.Context(), opts.bucket, dir)
+	if err != nil {
+		log.Printf("获取文件列表失败 %s: %v", dir, err)
+		h.responseError(w, r, opts, http.StatusInternalServerError, "获取文件列表失败")
+		return
+	}
+	entries := listEntries(objects, dir)
+	// 存储中没有空目录，没有条目的子目录视为不存在
+	if len(entries) == 0 && dir != opts.root {
+		h.notFound(w, r, dir, opts)
 		return
 	}
 
-	// 使用Minio API的公共URL
-	if h.config.Minio.UsePublicURL {
-		publicURL := h.minioService.GetPublicURL(filePath)
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(APIResponse{Code: 200, Message: "success", Data: entries})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	page := listingPage{
+		Path:    r.URL.Path,
+		Parent:  dir != opts.root,
+		Entries: entries,
+	}
+	if err := listingTemplate.Execute(w, page); err != nil {
+		log.Printf("输出目录列表失败 %s: %v", dir, err)
+	}
+}
+
+// 输出单个对象，策略不为 proxy 时跳转到预签名URL或公开地址
+func (h *DocsHandler) serveObject(w http.ResponseWriter, r *http.Request, key string, opts serveOptions) {
+	if opts.direct() {
+		publicURL, maxAge := objectURL(r.Context(), h.storage, key, opts)
 		if publicURL != "" {
+			// 预签名URL在缓存期间保持不变，跳转响应最多缓存到地址需要更新时
+			if maxAge > 0 {
+				w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+			}
 			if h.config.Logs.RedirectLog {
 				log.Printf("Redirect: %s -> %s", r.URL.Path, publicURL)
 			}
@@ -129,28 +302,128 @@ func (h *DocsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 如果获取公共URL失败或未启用，则使用代理方式
-	object, err := h.minioService.GetObject(filePath)
+	h.proxyObject(w, r, key, opts)
+}
+
+func (h *DocsHandler) proxyObject(w http.ResponseWriter, r *http.Request, key string, opts serveOptions) {
+	object, err := h.storage.Get(r.Context(), opts.bucket, key)
 	if err != nil {
-		log.Printf("获取文件失败 %s: %v", filePath, err)
-		http.Error(w, "文件不存在", http.StatusNotFound)
+		if errors.Is(err, os.ErrNotExist) {
+			h.responseError(w, r, opts, http.StatusNotFound, "文件不存在")
+			return
+		}
+		log.Printf("获取文件失败 %s: %v", key, err)
+		h.responseError(w, r, opts, http.StatusInternalServerError, "获取文件信息失败")
 		return
 	}
 	defer object.Close()
 
-	// 获取文件信息
-	info, err := object.Stat()
-	if err != nil {
-		log.Printf("获取文件信息失败 %s: %v", filePath, err)
-		http.Error(w, "文件不存在", http.StatusNotFound)
+	// 输出文件内容（支持 Range 和条件请求）
+	middleware.ServeObject(w, r, key, object, object.Info())
+}
+
+// 文件不存在：配置了单页应用入口时返回入口文件，由前端路由处理；
+// 带扩展名且不接受 HTML 的请求（如缺失的脚本、图片）仍然返回 404
+func (h *DocsHandler) notFound(w http.ResponseWriter, r *http.Request, key string, opts serveOptions) {
+	if opts.fallback != "" && key != opts.fallback && (path.Ext(strings.TrimSuffix(key, "/")) == "" || accepts(r, "text/html")) {
+		// 入口文件始终通过代理返回，浏览器地址保持不变
+		h.proxyObject(w, r, opts.fallback, serveOptions{bucket: opts.bucket, errorPages: opts.errorPages})
 		return
 	}
+	h.responseError(w, r, opts, http.StatusNotFound, "文件不存在")
+}
 
-	// 设置Content-Type和其他头信息
-	w.Header().Set("Content-Type", info.ContentType)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size))
+var errorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Status}} {{.Message}}</title>
+</head>
+<body>
+<h1>{{.Status}}</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+`))
 
-	// 直接复制文件内容到响应
-	if _, err := io.Copy(w, object); err != nil {
-		log.Printf("发送文件失败 %s: %v", filePath, err)
+// 输出错误：请求 JSON 时返回与 API 相同格式的 JSON，否则优先返回配置的错误页面，
+// 再根据 Accept 返回 HTML 或纯文本
+func (h *DocsHandler) responseError(w http.ResponseWriter, r *http.Request, opts serveOptions, code int, message string) {
+	if prefersJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(APIResponse{Code: code, Message: message})
+		return
+	}
+
+	if key := opts.errorPages[code]; key != "" {
+		object, err := h.storage.Get(r.Context(), opts.bucket, key)
+		if err == nil {
+			defer object.Close()
+			info := object.Info()
+			if info.ContentType != "" {
+				w.Header().Set("Content-Type", info.ContentType)
+			}
+			w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(code)
+			if r.Method != http.MethodHead {
+				io.Copy(w, object)
+			}
+			return
+		}
+		log.Printf("读取错误页面失败 %s: %v", key, err)
+	}
+
+	if accepts(r, "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(code)
+		errorTemplate.Execute(w, map[string]interface{}{"Status": code, "Message": message})
+		return
+	}
+	http.Error(w, message, code)
+}
+
+// Accept 中是否明确包含指定类型
+func accepts(r *http.Request, mediaType string) bool {
+	return acceptIndex(r.Header.Get("Accept"), mediaType) >= 0
+}
+
+// 是否优先接受 JSON：Accept 中 application/json 出现在 text/html 之前
+func prefersJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	jsonIndex := acceptIndex(accept, "application/json")
+	htmlIndex := acceptIndex(accept, "text/html")
+	return jsonIndex >= 0 && (htmlIndex < 0 || jsonIndex < htmlIndex)
+}
+
+// 媒体类型在 Accept 列表中的位置，不存在或 q=0 时返回 -1
+func acceptIndex(accept, mediaType string) int {
+	for i, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), mediaType) {
+			continue
+		}
+		for _, param := range fields[1:] {
+			if q := strings.TrimSpace(param); q == "q=0" || q == "q=0.0" {
+				return -1
+			}
+		}
+		return i
+	}
+	return -1
+}
+
+// 按访问设置生成对象的直接访问地址，maxAge 为地址可以被缓存的时长，0 表示不过期；
+// 由服务代理、存储后端不支持或生成失败时返回空字符串
+func objectURL(ctx context.Context, storage service.Storage, key string, opts serveOptions) (string, time.Duration) {
+	url, maxAge, err := service.ObjectURL(ctx, storage, opts.bucket, key, opts.urlPolicy)
+	if err != nil {
+		if !errors.Is(err, service.ErrNotSupported) {
+			log.Printf("生成访问地址失败 %s: %v", key, err)
+		}
+		return "", 0
 	}
+	return url, maxAge
 }
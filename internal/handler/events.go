@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"pysio.online/Files-API/internal/service"
+)
+
+// 心跳间隔，防止代理因连接空闲而断开；测试中可以缩短
+var sseHeartbeat = 15 * time.Second
+
+// 以 Server-Sent Events 推送同步状态变化和文件处理结果
+// 支持 ?minioPath=a&minioPath=b 或 ?minioPath=a,b 过滤仓库
+func (h *APIHandler) handleSyncEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.responseError(w, http.StatusMethodNotAllowed, "方法不允许")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.responseError(w, http.StatusInternalServerError, "当前连接不支持事件流")
+		return
+	}
+
+	var minioPaths []string
+	for _, v := range r.URL.Query()["minioPath"] {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				minioPaths = append(minioPaths, p)
+			}
+		}
+	}
+
+	// 先订阅再发送当前状态，避免遗漏两者之间的事件
+	events, unsubscribe := h.syncManager.SubscribeEvents(minioPaths)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // 禁用 Nginx 缓冲
+	w.WriteHeader(http.StatusOK)
+
+	// 连接建立后推送各仓库当前状态
+	filter := make(map[string]bool)
+	for _, p := range minioPaths {
+		filter[p] = true
+	}
+	for _, repo := range h.config.Git.Repositories {
+		if (len(filter) > 0 && !filter[repo.MinioPath]) || !repoVisible(r, repo.MinioPath) {
+			continue
+		}
+		writeSSE(w, service.SyncEvent{
+			Type:      service.EventStatus,
+			MinioPath: repo.MinioPath,
+			Time:      time.Now(),
+			Status:    h.syncManager.Status(repo.MinioPath),
+		})
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			// 只推送密钥允许访问的仓库
+			if !repoVisible(r, event.MinioPath) {
+				continue
+			}
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event service.SyncEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
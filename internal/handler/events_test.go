@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pysio.online/Files-API/internal/config"
+	"pysio.online/Files-API/internal/middleware"
+	"pysio.online/Files-API/internal/service"
+)
+
+// 读取事件流中的一条事件或心跳，返回事件类型和数据；心跳的类型为 "ping"
+func readSSE(t *testing.T, r *bufio.Reader) (string, string) {
+	t.Helper()
+	var event, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("读取事件流失败: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if event != "" || data != "" {
+				return event, data
+			}
+		case line == ": ping":
+			event = "ping"
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func openSSE(t *testing.T, server *httptest.Server, query, key string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/files/sync/events"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("事件流响应 %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func TestSyncEventsSnapshotAndHeartbeat(t *testing.T) {
+	heartbeat := sseHeartbeat
+	sseHeartbeat = 50 * time.Millisecond
+	defer func() { sseHeartbeat = heartbeat }()
+
+	h, _, _ := newSyncHandler(t, "docs", "blog", "app")
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	// 连接后先推送所选仓库的当前状态，之后空闲时发送心跳
+	r := openSSE(t, server, "?minioPath=docs,app", "")
+	var got []string
+	for i := 0; i < 2; i++ {
+		event, data := readSSE(t, r)
+		var e service.SyncEvent
+		if err := json.Unmarshal([]byte(data), &e); err != nil || event != service.EventStatus || e.Status == nil {
+			t.Fatalf("第 %d 条事件应为状态快照: %s %s", i+1, event, data)
+		}
+		got = append(got, e.MinioPath)
+	}
+	if strings.Join(got, ",") != "docs,app" {
+		t.Errorf("状态快照的仓库 = %v，期望 [docs app]", got)
+	}
+	if event, _ := readSSE(t, r); event != "ping" {
+		t.Errorf("空闲时应发送心跳，实际为 %s", event)
+	}
+}
+
+func TestSyncEventsOnlyStreamAllowedRepositories(t *testing.T) {
+	h, minioService, cfg := newSyncHandler(t, "docs", "blog")
+	cfg.Auth = config.AuthConfig{
+		Enabled: true,
+		Keys: []config.APIKey{
+			{Name: "docs", Key: "docs-key", Scopes: []string{middleware.ScopeRead}, Prefixes: []string{"docs"}},
+		},
+	}
+	server := httptest.NewServer(middleware.NewAuthMiddleware(&cfg.Auth, &cfg.Logs, nil).Middleware(h))
+	t.Cleanup(server.Close)
+
+	r := openSSE(t, server, "", "docs-key")
+	if _, data := readSSE(t, r); !strings.Contains(data, `"minioPath":"docs"`) {
+		t.Fatalf("状态快照应只包含 docs: %s", data)
+	}
+
+	// blog 的同步事件不会推送给只能访问 docs 的密钥
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("index"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := minioService.UploadDirectory(context.Background(), dir, "blog"); err != nil {
+		t.Fatal(err)
+	}
+	if err := minioService.UploadDirectory(context.Background(), dir, "docs"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		_, data := readSSE(t, r)
+		var e service.SyncEvent
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.MinioPath != "docs" {
+			t.Fatalf("不应推送仓库 %s 的事件", e.MinioPath)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"path"
+	"strings"
+
+	"pysio.online/Files-API/internal/service"
+)
+
+// 由前缀下的所有对象生成下一级的目录和文件条目，目录在首次出现的位置列出
+func listEntries(objects []service.ObjectInfo, prefix string) []FileInfo {
+	files := []FileInfo{}
+	seenDirs := make(map[string]bool)
+
+	for _, obj := range objects {
+		// 跳过当前目录和版本记录
+		if obj.Key == prefix || strings.HasPrefix(obj.Key, service.VersionsPrefix) {
+			continue
+		}
+
+		// 相对于当前目录的路径
+		relPath := strings.TrimPrefix(obj.Key, prefix)
+		parts := strings.Split(relPath, "/")
+
+		if len(parts) > 1 {
+			// 这是子目录中的文件，添加目录条目
+			dirName := parts[0]
+			dirPath := path.Join(prefix, dirName) + "/"
+			if !seenDirs[dirPath] {
+				files = append(files, FileInfo{
+					Name:        dirName,
+					Path:        dirPath,
+					IsDirectory: true,
+				})
+				seenDirs[dirPath] = true
+			}
+		} else {
+			// 这是文件
+			files = append(files, FileInfo{
+				Name:         path.Base(obj.Key),
+				Path:         obj.Key,
+				Size:         obj.Size,
+				LastModified: obj.LastModified,
+				IsDirectory:  false,
+			})
+		}
+	}
+	return files
+}
+
+// 目录列表页面的数据
+type listingPage struct {
+	Path    string // 请求的 URL 路径
+	Parent  bool   // 是否显示上级目录链接
+	Entries []FileInfo
+}
+
+var listingTemplate = template.Must(template.New("listing").Funcs(template.FuncMap{
+	"href": func(f FileInfo) string {
+		if f.IsDirectory {
+			return url.PathEscape(f.Name) + "/"
+		}
+		return url.PathEscape(f.Name)
+	},
+	"size": formatSize,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Path}} 的索引</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.25em 1.5em 0.25em 0; text-align: left; }
+td.size { text-align: right; }
+</style>
+</head>
+<body>
+<h1>{{.Path}} 的索引</h1>
+<table>
+<tr><th>名称</th><th>大小</th><th>修改时间</th></tr>
+{{- if .Parent}}
+<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{- end}}
+{{- range .Entries}}
+{{- if .IsDirectory}}
+<tr><td><a href="{{href .}}">{{.Name}}/</a></td><td class="size">-</td><td></td></tr>
+{{- else}}
+<tr><td><a href="{{href .}}">{{.Name}}</a></td><td class="size">{{size .Size}}</td><td>{{.LastModified.Format "2006-01-02 15:04:05"}}</td></tr>
+{{- end}}
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// 将字节数格式化为便于阅读的形式
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
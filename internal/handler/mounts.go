@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+// 挂载点：URL 前缀对应存储桶中的前缀
+type mount struct {
+	urlPath string       // 规范化的 URL 前缀，如 "/docs/v2"，根路径为 "/"
+	prefix  string       // 存储中的前缀，不含首尾的 /，为空表示整个存储桶
+	opts    serveOptions // 访问设置，包括存储桶
+}
+
+// 挂载表，按 URL 前缀从长到短排列，匹配时取最长的前缀
+type mountTable []*mount
+
+// 规范化 URL 前缀：以 / 开头，不以 / 结尾
+func cleanMountPath(p string) string {
+	return path.Clean("/" + strings.Trim(p, "/"))
+}
+
+// 由配置生成挂载表：
+// 存储桶挂载到 /{name}，仓库挂载到 /{minioPath}，暴露路径的 urlPath 挂载到 bucket 中的 minioPath；
+// 没有设置 bucket 的一级 minioPath 同时可以通过 /{minioPath} 访问，与之前的行为一致
+func newMountTable(cfg *config.Config) mountTable {
+	mounts := make(map[string]*mount)
+	// 同一 URL 前缀指向相同位置时合并设置；指向不同位置时 replace 为 true 才覆盖，否则保留先添加的
+	add := func(urlPath, bucket, prefix string, replace bool) *mount {
+		urlPath = cleanMountPath(urlPath)
+		prefix = strings.Trim(prefix, "/")
+		if m, ok := mounts[urlPath]; ok {
+			if m.opts.bucket == bucket && m.prefix == prefix {
+				return m
+			}
+			if !replace {
+				return nil
+			}
+		}
+		m := &mount{urlPath: urlPath, prefix: prefix, opts: baseServeOptions(cfg, bucket, prefix)}
+		mounts[urlPath] = m
+		return m
+	}
+
+	for _, bucket := range cfg.Buckets {
+		add(bucket.Name, bucket.Name, "", false)
+	}
+	for _, repo := range cfg.Git.Repositories {
+		add(repo.MinioPath, "", repo.MinioPath, false)
+	}
+	for i := range cfg.ExposedPaths {
+		exposed := &cfg.ExposedPaths[i]
+		if exposed.Bucket != "" || exposed.MinioPath == "" || strings.Contains(strings.Trim(exposed.MinioPath, "/"), "/") {
+			continue
+		}
+		if m := add(exposed.MinioPath, "", exposed.MinioPath, false); m != nil {
+			m.opts.applyExposed(exposed)
+		}
+	}
+	// 显式配置的 urlPath 优先于同名的存储桶和仓库
+	for i := range cfg.ExposedPaths {
+		if exposed := &cfg.ExposedPaths[i]; exposed.URLPath != "" {
+			add(exposed.URLPath, exposed.Bucket, exposed.MinioPath, true).opts.applyExposed(exposed)
+		}
+	}
+
+	table := make(mountTable, 0, len(mounts))
+	for _, m := range mounts {
+		m.opts.root = m.key("/")
+		table = append(table, m)
+	}
+	sort.Slice(table, func(i, j int) bool {
+		if len(table[i].urlPath) != len(table[j].urlPath) {
+			return len(table[i].urlPath) > len(table[j].urlPath)
+		}
+		return table[i].urlPath < table[j].urlPath
+	})
+	return table
+}
+
+// 所有站点根路径的挂载点，以站点配置的指针为键
+func newSiteMounts(cfg *config.Config, table mountTable) map[*config.Site]*mount {
+	sites := make(map[*config.Site]*mount, len(cfg.Sites))
+	for i := range cfg.Sites {
+		site := &cfg.Sites[i]
+		if m := newSiteMount(cfg, table, site); m != nil {
+			sites[site] = m
+		} else {
+			log.Printf("站点 %v 的 exposedPath 不存在: %s", site.Hosts, site.ExposedPath)
+		}
+	}
+	return sites
+}
+
+// 站点根路径的挂载点，exposedPath 不存在时返回 nil
+func newSiteMount(cfg *config.Config, table mountTable, site *config.Site) *mount {
+	var m mount
+	if site.ExposedPath != "" {
+		base, rest := table.match(cleanMountPath(site.ExposedPath))
+		if base == nil || rest != "" {
+			return nil
+		}
+		m = *base
+	} else {
+		m.prefix = strings.Trim(site.MinioPath, "/")
+		m.opts = baseServeOptions(cfg, site.Bucket, m.prefix)
+	}
+	m.urlPath = "/"
+	m.opts.root = m.key("/")
+
+	if site.Index != nil {
+		m.opts.index = site.Index
+	}
+	if site.Listing {
+		m.opts.listing = true
+	}
+	if site.Fallback != "" {
+		m.opts.fallback = m.key("/" + strings.TrimPrefix(site.Fallback, "/"))
+	}
+	if len(site.ErrorPages) > 0 {
+		pages := make(map[int]string, len(m.opts.errorPages)+len(site.ErrorPages))
+		for status, key := range m.opts.errorPages {
+			pages[status] = key
+		}
+		for status, page := range site.ErrorPages {
+			pages[status] = m.key("/" + strings.TrimPrefix(page, "/"))
+		}
+		m.opts.errorPages = pages
+	}
+	return &m
+}
+
+// 挂载点的基础访问设置，索引、目录列表和访问地址策略使用对应存储桶或仓库的配置
+func baseServeOptions(cfg *config.Config, bucket, prefix string) serveOptions {
+	for _, b := range cfg.Buckets {
+		if bucket != "" && b.Name == bucket && prefix == "" {
+			return newServeOptions(cfg, bucket, b.Index, b.Listing, b.URLPolicy)
+		}
+	}
+	for _, repo := range cfg.Git.Repositories {
+		if bucket == "" && strings.Trim(repo.MinioPath, "/") == prefix {
+			return newServeOptions(cfg, bucket, repo.Index, repo.Listing, repo.URLPolicy)
+		}
+	}
+	return newServeOptions(cfg, bucket, nil, false, config.URLPolicy{})
+}
+
+// 按最长前缀匹配 URL 路径，返回挂载点和剩余部分（为空或以 / 开头），没有匹配时返回 nil
+func (t mountTable) match(urlPath string) (*mount, string) {
+	for _, m := range t {
+		if m.urlPath == "/" {
+			return m, urlPath
+		}
+		if urlPath == m.urlPath || strings.HasPrefix(urlPath, m.urlPath+"/") {
+			return m, strings.TrimPrefix(urlPath, m.urlPath)
+		}
+	}
+	return nil, ""
+}
+
+// 剩余的 URL 路径对应的对象键，rest 为空时返回前缀本身
+func (m *mount) key(rest string) string {
+	if m.prefix == "" {
+		return strings.TrimPrefix(rest, "/")
+	}
+	return m.prefix + rest
+}
+
+// 挂载点中的对象键对应的 URL 路径（不含开头的 /）
+func (m *mount) urlKey(key string) string {
+	rel := "/" + key
+	if m.prefix != "" {
+		rel = strings.TrimPrefix(key, m.prefix)
+	}
+	return strings.TrimPrefix(strings.TrimSuffix(m.urlPath, "/")+rel, "/")
+}
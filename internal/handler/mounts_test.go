@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"testing"
+
+	"pysio.online/Files-API/internal/config"
+	"pysio.online/Files-API/internal/service"
+)
+
+func TestAPIHandlerBucketOf(t *testing.T) {
+	cfg := &config.Config{
+		Buckets:      []config.BucketConfig{{Name: "Images"}},
+		ExposedPaths: []config.ExposedPath{{URLPath: "/media/img", Bucket: "Images", MinioPath: "pics"}},
+	}
+	cfg.Git.Repositories = []config.Repository{{MinioPath: "docs"}}
+	h := NewAPIHandler(service.NewMemoryStorage(), nil, cfg)
+
+	cases := map[string]string{
+		"Images":           "Images",
+		"Images/photos/":   "Images",
+		"media/img/a.png":  "Images",
+		"docs/":            "",
+		"ImagesPrivate/":   "",
+		"unknown/path.txt": "",
+	}
+	for prefix, want := range cases {
+		if got := h.BucketOf(prefix); got != want {
+			t.Errorf("BucketOf(%q) = %q，期望 %q", prefix, got, want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"pysio.online/Files-API/internal/middleware"
+	"pysio.online/Files-API/internal/service"
+)
+
+// 解析 sync/{minioPath}/{action} 形式的路径
+func parseSyncAction(prefix string) (minioPath, action string, ok bool) {
+	if !strings.HasPrefix(prefix, "sync/") {
+		return "", "", false
+	}
+	rest := strings.TrimPrefix(prefix, "sync/")
+	idx := strings.LastIndex(rest, "/")
+	if idx <= 0 {
+		return "", "", false
+	}
+	action = rest[idx+1:]
+	switch action {
+	case "run", "cancel", "confirm", "dryrun", "versions", "rollback", "restamp":
+		return rest[:idx], action, true
+	}
+	return "", "", false
+}
+
+// 版本列表中的条目
+type versionInfo struct {
+	service.Version
+	Active bool `json:"active"` // 是否为当前发布的版本
+}
+
+// 回滚请求，version 和 commit 二选一
+type rollbackRequest struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+}
+
+// 处理手动同步、取消、确认删除、预演、版本列表、回滚和重新设置 Content-Type 请求
+func (h *APIHandler) handleSyncAction(w http.ResponseWriter, r *http.Request, minioPath, action string) {
+	if action == "versions" {
+		h.handleSyncVersions(w, r, minioPath)
+		return
+	}
+	if r.Method != http.MethodPost {
+		h.responseError(w, http.StatusMethodNotAllowed, "方法不允许")
+		return
+	}
+
+	// 启用API认证时由认证中间件校验 admin 权限，否则校验 auth.adminToken
+	if _, ok := middleware.AuthKeyFromContext(r.Context()); !ok {
+		if h.config.Auth.AdminToken == "" {
+			h.responseError(w, http.StatusForbidden, "未启用API认证且未配置管理令牌")
+			return
+		}
+		if !tokenEqual(bearerToken(r), h.config.Auth.AdminToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="Files-API"`)
+			h.responseError(w, http.StatusUnauthorized, "未授权")
+			return
+		}
+	}
+
+	if !h.syncManager.Running() {
+		h.responseError(w, http.StatusServiceUnavailable, "同步服务未启用")
+		return
+	}
+
+	repo := h.syncManager.FindRepository(minioPath)
+	if repo == nil {
+		h.responseError(w, http.StatusNotFound, "未找到指定的仓库")
+		return
+	}
+
+	// 记录触发者，启用认证时附带密钥名称
+	triggeredBy := service.TriggerAPI
+	switch action {
+	case "rollback":
+		triggeredBy = service.TriggerRollback
+	case "confirm":
+		triggeredBy = service.TriggerConfirm
+	}
+	if key, ok := middleware.AuthKeyFromContext(r.Context()); ok {
+		triggeredBy += ":" + key.Name
+	}
+
+	switch action {
+	case "run":
+		if !h.syncManager.Enqueue(repo, triggeredBy) {
+			h.responseError(w, http.StatusConflict, "已有排队中的同步任务")
+			return
+		}
+		h.responseSuccess(w, map[string]string{"minioPath": minioPath, "triggeredBy": triggeredBy}, nil)
+	case "confirm":
+		pending := h.syncManager.Status(minioPath).PendingDeletions
+		if pending == 0 {
+			h.responseError(w, http.StatusConflict, "当前没有等待确认的删除")
+			return
+		}
+		if !h.syncManager.EnqueueConfirmed(repo, triggeredBy) {
+			h.responseError(w, http.StatusConflict, "已有排队中的同步任务")
+			return
+		}
+		h.responseSuccess(w, map[string]interface{}{"minioPath": minioPath, "triggeredBy": triggeredBy, "pendingDeletions": pending}, nil)
+	case "dryrun":
+		plan, err := h.syncManager.DryRun(r.Context(), repo)
+		if err != nil {
+			log.Printf("生成同步计划失败 %s: %v", minioPath, err)
+			h.responseError(w, http.StatusInternalServerError, "生成同步计划失败")
+			return
+		}
+		h.responseSuccess(w, plan, nil)
+	case "restamp":
+		result, err := h.syncManager.Restamp(r.Context(), repo, r.URL.Query().Get("dryRun") == "true")
+		if err != nil {
+			log.Printf("重新设置 Content-Type 失败 %s: %v", minioPath, err)
+			h.responseError(w, http.StatusInternalServerError, "重新设置 Content-Type 失败")
+			return
+		}
+		h.responseSuccess(w, result, nil)
+	case "cancel":
+		if h.syncManager.Cancel(minioPath) == 0 {
+			h.responseError(w, http.StatusConflict, "当前没有进行中的同步")
+			return
+		}
+		h.responseSuccess(w, map[string]string{"minioPath": minioPath}, nil)
+	case "rollback":
+		var req rollbackRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.responseError(w, http.StatusBadRequest, "无效的请求体")
+			return
+		}
+		ref := req.Version
+		if ref == "" {
+			ref = req.Commit
+		}
+		if ref == "" {
+			h.responseError(w, http.StatusBadRequest, "缺少 version 或 commit 参数")
+			return
+		}
+
+		version, err := h.syncManager.FindVersion(r.Context(), minioPath, ref)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				h.responseError(w, http.StatusNotFound, "未找到指定的版本")
+				return
+			}
+			log.Printf("查找版本失败 %s: %v", minioPath, err)
+			h.responseError(w, http.StatusInternalServerError, "查找版本失败")
+			return
+		}
+		if !h.syncManager.EnqueueRollback(repo, version, triggeredBy) {
+			h.responseError(w, http.StatusConflict, "已有排队中的同步任务")
+			return
+		}
+		h.responseSuccess(w, map[string]string{
+			"minioPath":   minioPath,
+			"version":     version.ID,
+			"commit":      version.Commit,
+			"triggeredBy": triggeredBy,
+		}, nil)
+	}
+}
+
+// 列出仓库的版本记录
+func (h *APIHandler) handleSyncVersions(w http.ResponseWriter, r *http.Request, minioPath string) {
+	if r.Method != http.MethodGet {
+		h.responseError(w, http.StatusMethodNotAllowed, "方法不允许")
+		return
+	}
+	if h.syncManager.FindRepository(minioPath) == nil {
+		h.responseError(w, http.StatusNotFound, "未找到指定的仓库")
+		return
+	}
+
+	versions, err := h.syncManager.Versions(r.Context(), minioPath)
+	if err != nil {
+		log.Printf("获取版本列表失败 %s: %v", minioPath, err)
+		h.responseError(w, http.StatusInternalServerError, "获取版本列表失败")
+		return
+	}
+
+	active := h.syncManager.Status(minioPath).Version
+	list := make([]versionInfo, 0, len(versions))
+	for _, v := range versions {
+		list = append(list, versionInfo{Version: v, Active: v.ID == active})
+	}
+	h.responseSuccess(w, list, nil)
+}
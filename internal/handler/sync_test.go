@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"pysio.online/Files-API/internal/config"
+	"pysio.online/Files-API/internal/middleware"
+	"pysio.online/Files-API/internal/service"
+)
+
+func TestSyncActionsRequireAdminWithoutAuth(t *testing.T) {
+	cfg := &config.Config{}
+	h := NewAPIHandler(service.NewMemoryStorage(), service.NewSyncManager(cfg, nil, nil), cfg)
+
+	for _, action := range []string{"run", "cancel", "confirm", "dryrun", "rollback", "restamp"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/files/sync/docs/"+action, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: 未启用认证且未配置管理令牌时应返回 403，实际为 %d", action, w.Code)
+		}
+	}
+
+	cfg.Auth.AdminToken = "secret"
+	for _, token := range []string{"", "wrong"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/files/sync/docs/run", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("令牌 %q: 应返回 401，实际为 %d", token, w.Code)
+		}
+	}
+
+	// 令牌正确时通过校验，同步服务未启动
+	req := httptest.NewRequest(http.MethodPost, "/api/files/sync/docs/run", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("令牌正确时应通过校验，实际为 %d", w.Code)
+	}
+}
+
+// 使用内存存储的处理器，仓库按 minioPaths 配置
+func newSyncHandler(t *testing.T, minioPaths ...string) (*APIHandler, *service.MinioService, *config.Config) {
+	t.Helper()
+	cfg := &config.Config{Storage: config.StorageConfig{Driver: service.DriverMemory}}
+	cfg.Git.StateFile = filepath.Join(t.TempDir(), "sync-state.json")
+	for _, minioPath := range minioPaths {
+		cfg.Git.Repositories = append(cfg.Git.Repositories, config.Repository{MinioPath: minioPath})
+	}
+	minioService, err := service.NewMinioService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewAPIHandler(minioService.Storage(), service.NewSyncManager(cfg, nil, minioService), cfg)
+	return h, minioService, cfg
+}
+
+func TestSyncStatusOnlyShowsAllowedRepositories(t *testing.T) {
+	h, _, cfg := newSyncHandler(t, "docs", "docs-private", "blog")
+	cfg.Auth = config.AuthConfig{
+		Enabled: true,
+		Keys: []config.APIKey{
+			{Name: "docs", Key: "docs-key", Scopes: []string{middleware.ScopeRead}, Prefixes: []string{"docs"}},
+			{Name: "all", Key: "all-key", Scopes: []string{middleware.ScopeRead}},
+		},
+	}
+	handler := middleware.NewAuthMiddleware(&cfg.Auth, &cfg.Logs, nil).Middleware(h)
+
+	cases := map[string][]string{
+		"docs-key": {"docs"},
+		"all-key":  {"blog", "docs", "docs-private"},
+	}
+	for key, want := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/files/sync/status", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: 状态码 %d", key, w.Code)
+		}
+		var resp SyncStatusResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for minioPath := range resp.Data {
+			got = append(got, minioPath)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: 可见的仓库 = %v，期望 %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pysio.online/Files-API/internal/config"
+	"pysio.online/Files-API/internal/service"
+)
+
+// Webhook 请求体大小上限
+const maxWebhookBody = 5 << 20
+
+// 推送事件中用到的字段，兼容 GitHub、Gitea 和 GitLab
+type pushPayload struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+		HTMLURL  string `json:"html_url"`
+		SSHURL   string `json:"ssh_url"`
+		GitURL   string `json:"git_url"`
+		URL      string `json:"url"`
+		Homepage string `json:"homepage"`
+	} `json:"repository"`
+	Project struct {
+		GitHTTPURL string `json:"git_http_url"`
+		GitSSHURL  string `json:"git_ssh_url"`
+		WebURL     string `json:"web_url"`
+	} `json:"project"`
+}
+
+func (p *pushPayload) urls() []string {
+	return []string{
+		p.Repository.CloneURL, p.Repository.HTMLURL, p.Repository.SSHURL, p.Repository.GitURL,
+		p.Repository.URL, p.Repository.Homepage,
+		p.Project.GitHTTPURL, p.Project.GitSSHURL, p.Project.WebURL,
+	}
+}
+
+// 处理推送 Webhook，校验签名后立即同步匹配的仓库
+func (h *APIHandler) handleSyncWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.responseError(w, http.StatusMethodNotAllowed, "方法不允许")
+		return
+	}
+
+	// 识别来源平台，Gitea 同时会发送 X-GitHub-Event，需优先判断
+	var provider, event string
+	switch {
+	case r.Header.Get("X-Gitea-Event") != "":
+		provider, event = "gitea", r.Header.Get("X-Gitea-Event")
+	case r.Header.Get("X-GitHub-Event") != "":
+		provider, event = "github", r.Header.Get("X-GitHub-Event")
+	case r.Header.Get("X-Gitlab-Event") != "":
+		provider, event = "gitlab", r.Header.Get("X-Gitlab-Event")
+	default:
+		h.responseError(w, http.StatusBadRequest, "无法识别的 Webhook 来源")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		h.responseError(w, http.StatusBadRequest, "读取请求体失败")
+		return
+	}
+
+	// GitHub 配置 Webhook 时会发送 ping 事件
+	if event == "ping" {
+		h.responseSuccess(w, nil, nil)
+		return
+	}
+	if event != "push" && event != "Push Hook" {
+		h.responseSuccess(w, map[string]string{"ignored": event}, nil)
+		return
+	}
+
+	var payload pushPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		h.responseError(w, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+
+	// 按仓库地址匹配，再校验签名和分支
+	verified := false
+	var repos []*config.Repository
+	for i := range h.config.Git.Repositories {
+		repo := &h.config.Git.Repositories[i]
+		if !repoURLMatches(repo.URL, payload.urls()) {
+			continue
+		}
+		if repo.WebhookSecret == "" || !verifyWebhookSignature(provider, r, body, repo.WebhookSecret) {
+			continue
+		}
+		verified = true
+		// 固定到提交的仓库不随推送更新，固定到标签的仓库只响应该标签的推送
+		watched := "refs/heads/" + repo.Branch
+		if repo.Tag != "" {
+			watched = "refs/tags/" + repo.Tag
+		}
+		if repo.DisabledSync || repo.Source != "" && repo.Source != service.SourceGit || repo.Commit != "" || payload.Ref != watched {
+			continue
+		}
+		repos = append(repos, repo)
+	}
+
+	// 没有匹配的仓库与签名错误返回相同的结果，避免探测配置了哪些仓库
+	if !verified {
+		log.Printf("Webhook 签名校验失败: %s %s", provider, r.RemoteAddr)
+		h.responseError(w, http.StatusUnauthorized, "签名校验失败")
+		return
+	}
+	if len(repos) > 0 && !h.syncManager.Running() {
+		h.responseError(w, http.StatusServiceUnavailable, "同步服务未启用")
+		return
+	}
+
+	// 已有排队中任务的仓库不会重复添加，但仍视为已排队
+	queued := []string{}
+	for _, repo := range repos {
+		log.Printf("收到 %s 推送，加入同步队列: %s (%s)", provider, repo.URL, payload.Ref)
+		h.syncManager.Enqueue(repo, service.TriggerWebhook+":"+provider)
+		queued = append(queued, repo.MinioPath)
+	}
+
+	h.responseSuccess(w, map[string][]string{"queued": queued}, nil)
+}
+
+// 校验 Webhook 签名：GitHub/Gitea 使用 HMAC-SHA256，GitLab 使用明文令牌
+func verifyWebhookSignature(provider string, r *http.Request, body []byte, secret string) bool {
+	switch provider {
+	case "gitlab":
+		return tokenEqual(r.Header.Get("X-Gitlab-Token"), secret)
+	case "gitea":
+		return hmacEqual(r.Header.Get("X-Gitea-Signature"), body, secret)
+	case "github":
+		sig := r.Header.Get("X-Hub-Signature-256")
+		if !strings.HasPrefix(sig, "sha256=") {
+			return false
+		}
+		return hmacEqual(strings.TrimPrefix(sig, "sha256="), body, secret)
+	}
+	return false
+}
+
+func hmacEqual(signature string, body []byte, secret string) bool {
+	expected, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// 比较仓库地址，忽略协议、大小写、.git 后缀以及 SSH 地址格式差异
+func repoURLMatches(configured string, candidates []string) bool {
+	want := normalizeRepoURL(configured)
+	if want == "" {
+		return false
+	}
+	for _, c := range candidates {
+		if c != "" && normalizeRepoURL(c) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeRepoURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	// git@host:owner/repo.git 形式的 SSH 地址
+	if !strings.Contains(raw, "://") {
+		if at := strings.Index(raw, "@"); at >= 0 {
+			raw = raw[at+1:]
+		}
+		raw = "ssh://" + strings.Replace(raw, ":", "/", 1)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	p := strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+	return strings.ToLower(u.Hostname() + p)
+}
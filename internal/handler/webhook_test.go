@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pysio.online/Files-API/internal/config"
+	"pysio.online/Files-API/internal/service"
+)
+
+func webhookSignature(body, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestSyncWebhookVerifiesSignatureAndRef(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Git.Repositories = []config.Repository{
+		{URL: "https://github.com/user/docs.git", Branch: "main", MinioPath: "docs", WebhookSecret: "secret"},
+	}
+	h := NewAPIHandler(service.NewMemoryStorage(), service.NewSyncManager(cfg, nil, nil), cfg)
+
+	push := func(ref, url string) string {
+		return `{"ref": "` + ref + `", "repository": {"clone_url": "` + url + `"}, "project": {"git_http_url": "` + url + `"}}`
+	}
+	main := push("refs/heads/main", "https://github.com/User/docs")
+	dev := push("refs/heads/dev", "git@github.com:user/docs.git")
+	other := push("refs/heads/main", "https://github.com/user/other")
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		body    string
+		want    int
+	}{
+		// 签名正确且分支匹配时加入同步队列，同步服务未启动时返回 503
+		{"github", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + webhookSignature(main, "secret")}, main, http.StatusServiceUnavailable},
+		{"github 其他分支", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + webhookSignature(dev, "secret")}, dev, http.StatusOK},
+		{"github 签名错误", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + webhookSignature(main, "wrong")}, main, http.StatusUnauthorized},
+		{"github 缺少前缀", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": webhookSignature(main, "secret")}, main, http.StatusUnauthorized},
+		{"gitea", map[string]string{"X-Gitea-Event": "push", "X-GitHub-Event": "push", "X-Gitea-Signature": webhookSignature(main, "secret")}, main, http.StatusServiceUnavailable},
+		{"gitea 签名错误", map[string]string{"X-Gitea-Event": "push", "X-Gitea-Signature": "not-hex"}, main, http.StatusUnauthorized},
+		{"gitlab", map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "secret"}, main, http.StatusServiceUnavailable},
+		{"gitlab 令牌错误", map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "wrong"}, main, http.StatusUnauthorized},
+		// 未配置的仓库与签名错误返回相同的状态码
+		{"未配置的仓库", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + webhookSignature(other, "secret")}, other, http.StatusUnauthorized},
+		{"ping", map[string]string{"X-GitHub-Event": "ping"}, `{}`, http.StatusOK},
+		{"未知来源", nil, main, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/files/sync/webhook", strings.NewReader(c.body))
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.want {
+			t.Errorf("%s: 状态码 %d，期望 %d: %s", c.name, w.Code, c.want, w.Body.String())
+		}
+	}
+}
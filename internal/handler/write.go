@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"pysio.online/Files-API/internal/config"
+	"pysio.online/Files-API/internal/middleware"
+	"pysio.online/Files-API/internal/service"
+)
+
+// multipart 表单在内存中保留的最大字节数，超出部分写入临时文件
+const multipartMemory = 32 << 20
+
+// 处理写入请求：PUT 上传/替换、POST multipart 上传、DELETE 删除
+// 路径格式：/api/files/{bucket}/{path}
+func (h *APIHandler) handleWriteRequest(w http.ResponseWriter, r *http.Request, prefix string) {
+	parts := strings.SplitN(prefix, "/", 2)
+	bucketName := parts[0]
+	objectPath := ""
+	if len(parts) > 1 {
+		objectPath = strings.Trim(parts[1], "/")
+	}
+
+	// 检查桶是否存在且可写
+	var bucketConfig *config.BucketConfig
+	for i := range h.config.Buckets {
+		if h.config.Buckets[i].Name == bucketName {
+			bucketConfig = &h.config.Buckets[i]
+			break
+		}
+	}
+	if bucketConfig == nil {
+		h.responseError(w, http.StatusNotFound, "存储桶不存在")
+		return
+	}
+	if bucketConfig.ReadOnly {
+		h.responseError(w, http.StatusForbidden, "存储桶为只读")
+		return
+	}
+
+	// 启用API认证时由认证中间件校验 write 权限，否则校验桶的写入令牌
+	if _, ok := middleware.AuthKeyFromContext(r.Context()); !ok {
+		if bucketConfig.WriteToken == "" {
+			h.responseError(w, http.StatusForbidden, "存储桶未配置写入令牌")
+			return
+		}
+		if !tokenEqual(bearerToken(r), bucketConfig.WriteToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="Files-API"`)
+			h.responseError(w, http.StatusUnauthorized, "未授权")
+			return
+		}
+	}
+
+	// 限制请求体大小
+	if bucketConfig.MaxUploadSize > 0 && r.Method != http.MethodDelete {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(bucketConfig.MaxUploadSize)*1024*1024)
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		h.handlePutObject(w, r, bucketConfig, objectPath)
+	case http.MethodPost:
+		h.handleUploadForm(w, r, bucketConfig, objectPath)
+	case http.MethodDelete:
+		h.handleDeleteObject(w, r, bucketConfig, objectPath)
+	default:
+		h.responseError(w, http.StatusMethodNotAllowed, "方法不允许")
+	}
+}
+
+// PUT：使用请求体上传或替换单个文件
+func (h *APIHandler) handlePutObject(w http.ResponseWriter, r *http.Request, bucket *config.BucketConfig, objectPath string) {
+	if objectPath == "" || strings.HasSuffix(r.URL.Path, "/") {
+		h.responseError(w, http.StatusBadRequest, "缺少文件路径")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if !typeAllowed(bucket.AllowedTypes, contentType, objectPath) {
+		h.responseError(w, http.StatusUnsupportedMediaType, "不允许的文件类型")
+		return
+	}
+
+	info, err := h.storage.Put(r.Context(), bucket.Name, objectPath, r.Body, r.ContentLength, service.PutOptions{ContentType: contentType})
+	if err != nil {
+		h.writeUploadError(w, objectPath, err)
+		return
+	}
+
+	if h.config.Logs.ProcessLog {
+		log.Printf("Upload: %s/%s (%d bytes)", bucket.Name, objectPath, info.Size)
+	}
+	h.responseSuccess(w, uploadedFileInfo(objectPath, info.Size, info.LastModified), nil)
+}
+
+// POST：multipart/form-data 上传，支持多个 file 字段，保存到 {path}/{文件名}
+func (h *APIHandler) handleUploadForm(w http.ResponseWriter, r *http.Request, bucket *config.BucketConfig, dir string) {
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			h.responseError(w, http.StatusRequestEntityTooLarge, "文件大小超出限制")
+			return
+		}
+		h.responseError(w, http.StatusBadRequest, "无效的上传表单")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	headers := r.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		h.responseError(w, http.StatusBadRequest, "缺少上传文件")
+		return
+	}
+
+	// 先检查所有文件，避免部分上传
+	for _, fh := range headers {
+		if _, ok := uploadObjectPath(dir, fh.Filename); !ok {
+			h.responseError(w, http.StatusBadRequest, "无效的文件名")
+			return
+		}
+		if !typeAllowed(bucket.AllowedTypes, fh.Header.Get("Content-Type"), fh.Filename) {
+			h.responseError(w, http.StatusUnsupportedMediaType, "不允许的文件类型: "+fh.Filename)
+			return
+		}
+	}
+
+	var files []FileInfo
+	for _, fh := range headers {
+		objectPath, _ := uploadObjectPath(dir, fh.Filename)
+		file, err := fh.Open()
+		if err != nil {
+			h.responseError(w, http.StatusBadRequest, "读取上传文件失败")
+			return
+		}
+		info, err := h.storage.Put(r.Context(), bucket.Name, objectPath, file, fh.Size, service.PutOptions{ContentType: fh.Header.Get("Content-Type")})
+		file.Close()
+		if err != nil {
+			h.writeUploadError(w, objectPath, err)
+			return
+		}
+		if h.config.Logs.ProcessLog {
+			log.Printf("Upload: %s/%s (%d bytes)", bucket.Name, objectPath, info.Size)
+		}
+		files = append(files, uploadedFileInfo(objectPath, info.Size, info.LastModified))
+	}
+
+	h.responseSuccess(w, files, nil)
+}
+
+// DELETE：删除单个文件
+func (h *APIHandler) handleDeleteObject(w http.ResponseWriter, r *http.Request, bucket *config.BucketConfig, objectPath string) {
+	if objectPath == "" {
+		h.responseError(w, http.StatusBadRequest, "缺少文件路径")
+		return
+	}
+
+	if _, err := h.storage.Stat(r.Context(), bucket.Name, objectPath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			h.responseError(w, http.StatusNotFound, "文件不存在")
+			return
+		}
+		log.Printf("获取文件信息失败 %s/%s: %v", bucket.Name, objectPath, err)
+		h.responseError(w, http.StatusInternalServerError, "获取文件信息失败")
+		return
+	}
+
+	if err := h.storage.Remove(r.Context(), bucket.Name, objectPath); err != nil {
+		log.Printf("删除文件失败 %s/%s: %v", bucket.Name, objectPath, err)
+		h.responseError(w, http.StatusInternalServerError, "删除文件失败")
+		return
+	}
+
+	if h.config.Logs.ProcessLog {
+		log.Printf("Delete: %s/%s", bucket.Name, objectPath)
+	}
+	h.responseSuccess(w, FileInfo{Name: path.Base(objectPath), Path: objectPath}, nil)
+}
+
+func (h *APIHandler) writeUploadError(w http.ResponseWriter, objectPath string, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		h.responseError(w, http.StatusRequestEntityTooLarge, "文件大小超出限制")
+		return
+	}
+	log.Printf("上传文件失败 %s: %v", objectPath, err)
+	h.responseError(w, http.StatusInternalServerError, "上传文件失败")
+}
+
+// 上传表单中文件的保存路径，文件名只取最后一段，且结果必须位于 dir 下
+func uploadObjectPath(dir, filename string) (string, bool) {
+	name := path.Base(filename)
+	if filename == "" || name == "." || name == ".." || name == "/" {
+		return "", false
+	}
+	objectPath := path.Clean(path.Join(dir, name))
+	if dir == "" {
+		return objectPath, !strings.Contains(objectPath, "/")
+	}
+	return objectPath, strings.HasPrefix(objectPath, dir+"/")
+}
+
+func uploadedFileInfo(objectPath string, size int64, lastModified time.Time) FileInfo {
+	if lastModified.IsZero() {
+		lastModified = time.Now()
+	}
+	return FileInfo{
+		Name:         path.Base(objectPath),
+		Path:         objectPath,
+		Size:         size,
+		LastModified: lastModified,
+	}
+}
+
+// 检查 Content-Type 是否在允许列表中，未声明类型时按扩展名推断
+func typeAllowed(allowed []string, contentType, filename string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(mime.TypeByExtension(path.Ext(filename)))
+	}
+	if mediaType == "" {
+		return false
+	}
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*/*" || pattern == mediaType {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// 从 Authorization 头中提取 Bearer 令牌
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// 常量时间比较令牌，先做哈希以避免泄露长度信息
+func tokenEqual(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
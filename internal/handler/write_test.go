@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pysio.online/Files-API/internal/config"
+	"pysio.online/Files-API/internal/service"
+)
+
+func TestUploadObjectPath(t *testing.T) {
+	cases := []struct {
+		dir, filename string
+		want          string
+		ok            bool
+	}{
+		{"uploads", "a.png", "uploads/a.png", true},
+		{"uploads", "photos/a.png", "uploads/a.png", true},
+		{"", "a.png", "a.png", true},
+		{"uploads", "..", "", false},
+		{"uploads", ".", "", false},
+		{"uploads", "/", "", false},
+		{"uploads", "", "", false},
+		{"", "..", "", false},
+		{"a/../b", "x.txt", "", false},
+	}
+	for _, c := range cases {
+		got, ok := uploadObjectPath(c.dir, c.filename)
+		if ok != c.ok || (ok && got != c.want) {
+			t.Errorf("uploadObjectPath(%q, %q) = %q, %v，期望 %q, %v", c.dir, c.filename, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestUploadFormRejectsParentFilename(t *testing.T) {
+	cfg := &config.Config{Buckets: []config.BucketConfig{{Name: "uploads", WriteToken: "secret"}}}
+	storage := service.NewMemoryStorage()
+	h := NewAPIHandler(storage, nil, cfg)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("evil"))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/files/uploads/users/alice/", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("文件名为 .. 时应返回 400，实际为 %d", w.Code)
+	}
+
+	objects, err := storage.List(context.Background(), "uploads", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("不应写入任何对象，实际为 %v", objects)
+	}
+}
@@ -0,0 +1,254 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+// 权限范围
+const (
+	ScopeRead  = "read"  // 读取文件信息、同步状态
+	ScopeList  = "list"  // 列出目录
+	ScopeWrite = "write" // 上传、删除文件
+	ScopeAdmin = "admin" // 全部权限
+)
+
+type authContextKey struct{}
+
+// AuthKey 已通过认证的密钥信息
+type AuthKey struct {
+	Name     string
+	Scopes   []string
+	Prefixes []string
+	Buckets  []string
+}
+
+type authEntry struct {
+	hash [sha256.Size]byte
+	key  *AuthKey
+}
+
+type AuthMiddleware struct {
+	config    *config.AuthConfig
+	logAccess bool
+	entries   []authEntry
+	anonymous *AuthKey
+	bucketOf  func(prefix string) string // 列表请求的路径所在的存储桶，按挂载表解析
+}
+
+// bucketOf 返回 /api/files/ 之后的路径对应的存储桶名称，默认存储返回空字符串；为 nil 时不解析
+func NewAuthMiddleware(cfg *config.AuthConfig, logs *config.LogConfig, bucketOf func(prefix string) string) *AuthMiddleware {
+	m := &AuthMiddleware{
+		config:    cfg,
+		logAccess: logs.AccessLog,
+		anonymous: &AuthKey{Name: "anonymous", Scopes: cfg.AnonymousScopes},
+		bucketOf:  bucketOf,
+	}
+	for _, k := range cfg.Keys {
+		if k.Key == "" {
+			log.Printf("API密钥 %s 未设置密钥内容，已忽略", k.Name)
+			continue
+		}
+		m.entries = append(m.entries, authEntry{
+			hash: sha256.Sum256([]byte(k.Key)),
+			key: &AuthKey{
+				Name:     k.Name,
+				Scopes:   k.Scopes,
+				Prefixes: k.Prefixes,
+				Buckets:  k.Buckets,
+			},
+		})
+	}
+	return m
+}
+
+// AuthKeyFromContext 获取通过认证中间件的密钥，未启用认证时返回 false
+func AuthKeyFromContext(ctx context.Context) (*AuthKey, bool) {
+	key, ok := ctx.Value(authContextKey{}).(*AuthKey)
+	return key, ok
+}
+
+// HasScope 检查密钥是否拥有指定权限，admin 拥有全部权限
+func (k *AuthKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRepo 检查密钥是否允许访问仓库的同步状态、事件和版本，仓库位于默认存储的 minioPath 下
+func (k *AuthKey) AllowsRepo(minioPath string) bool {
+	return k.allows("", minioPath)
+}
+
+// 检查密钥是否允许访问指定桶或路径
+func (k *AuthKey) allows(bucket, target string) bool {
+	if len(k.Prefixes) == 0 && len(k.Buckets) == 0 {
+		return true
+	}
+	if bucket != "" {
+		for _, b := range k.Buckets {
+			if b == bucket {
+				return true
+			}
+		}
+	}
+	target = strings.TrimPrefix(target, "/")
+	for _, p := range k.Prefixes {
+		// 按路径分段匹配，docs 不匹配 docs-private
+		p = strings.Trim(p, "/")
+		if p == "" || target == p || strings.HasPrefix(target, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// 查找密钥，遍历全部条目以保证比较耗时恒定
+func (m *AuthMiddleware) lookup(token string) *AuthKey {
+	hash := sha256.Sum256([]byte(token))
+	var found *AuthKey
+	for _, e := range m.entries {
+		if subtle.ConstantTimeCompare(hash[:], e.hash[:]) == 1 {
+			found = e.key
+		}
+	}
+	return found
+}
+
+// 从请求中提取密钥，支持 Authorization: Bearer 和 X-API-Key
+// 浏览器的 EventSource 无法设置请求头，事件流额外支持 access_token 查询参数
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return key
+	}
+	if isEventStream(r) {
+		return strings.TrimSpace(r.URL.Query().Get("access_token"))
+	}
+	return ""
+}
+
+// 是否为同步事件流请求
+func isEventStream(r *http.Request) bool {
+	return r.URL.Path == "/api/files/sync/events"
+}
+
+// 根据请求判断所需权限以及访问的桶和路径
+// perRepo 为 true 时不校验路径，由处理函数按密钥允许的仓库过滤结果
+func (m *AuthMiddleware) requiredAccess(r *http.Request) (scope, bucket, target string, perRepo bool) {
+	prefix := strings.TrimPrefix(r.URL.Path, "/api/files/")
+
+	if strings.HasSuffix(r.URL.Path, "/sync/status") || isEventStream(r) {
+		return ScopeRead, "", "", true
+	}
+	// Webhook 由各仓库的签名密钥校验
+	if prefix == "sync/webhook" {
+		return "", "", "", false
+	}
+	// 手动同步、取消、确认删除、预演、回滚和重新设置 Content-Type 需要 admin 权限
+	// 路径为 sync/{minioPath}/{action}，按仓库的 minioPath 校验
+	if strings.HasPrefix(prefix, "sync/") {
+		minioPath := path.Dir(strings.TrimPrefix(prefix, "sync/"))
+		switch path.Base(prefix) {
+		case "run", "cancel", "confirm", "dryrun", "rollback", "restamp":
+			return ScopeAdmin, "", minioPath, false
+		case "versions":
+			return ScopeRead, "", minioPath, false
+		}
+	}
+
+	switch r.Method {
+	case http.MethodPatch:
+		// PATCH 的桶和路径位于请求体中，读取后放回
+		var req struct {
+			Bucket string `json:"bucket"`
+			Path   string `json:"path"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		json.Unmarshal(body, &req)
+		return ScopeRead, req.Bucket, req.Bucket + "/" + strings.TrimPrefix(req.Path, "/"), false
+	case http.MethodPut, http.MethodPost, http.MethodDelete:
+		return ScopeWrite, strings.SplitN(prefix, "/", 2)[0], prefix, false
+	}
+	if m.bucketOf != nil {
+		bucket = m.bucketOf(prefix)
+	}
+	return ScopeList, bucket, prefix, false
+}
+
+func (m *AuthMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.config.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scope, bucket, target, perRepo := m.requiredAccess(r)
+		if scope == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := m.anonymous
+		if token := requestToken(r); token != "" {
+			key = m.lookup(token)
+			if key == nil {
+				if m.logAccess {
+					log.Printf("API Auth rejected: invalid key %s %s %s", r.Method, r.URL.Path, r.RemoteAddr)
+				}
+				w.Header().Set("WWW-Authenticate", `Bearer realm="Files-API"`)
+				writeAuthError(w, http.StatusUnauthorized, "无效的API密钥")
+				return
+			}
+		}
+
+		if !key.HasScope(scope) {
+			if key == m.anonymous {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="Files-API"`)
+				writeAuthError(w, http.StatusUnauthorized, "需要API密钥")
+				return
+			}
+			if m.logAccess {
+				log.Printf("API Auth denied: %s lacks %s scope for %s %s", key.Name, scope, r.Method, r.URL.Path)
+			}
+			writeAuthError(w, http.StatusForbidden, "权限不足")
+			return
+		}
+		if !perRepo && !key.allows(bucket, target) {
+			if m.logAccess {
+				log.Printf("API Auth denied: %s not allowed to access %s %s", key.Name, r.Method, r.URL.Path)
+			}
+			writeAuthError(w, http.StatusForbidden, "无权访问该路径")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authContextKey{}, key)))
+	})
+}
+
+// 以 APIResponse 相同的格式返回错误
+func writeAuthError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}{code, message})
+}
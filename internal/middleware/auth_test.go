@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+func TestAuthKeyPrefixesMatchWholeSegments(t *testing.T) {
+	key := &AuthKey{Prefixes: []string{"docs", "/static/"}}
+	cases := map[string]bool{
+		"docs":                true,
+		"docs/":               true,
+		"docs/guide/index.md": true,
+		"/docs/a.txt":         true,
+		"docs-private":        false,
+		"docs-private/a.txt":  false,
+		"static/css/app.css":  true,
+		"staticfiles/app.css": false,
+		"other/docs/index.md": false,
+	}
+	for target, want := range cases {
+		if got := key.allows("", target); got != want {
+			t.Errorf("allows(%q) = %v，期望 %v", target, got, want)
+		}
+	}
+}
+
+func TestBucketScopedKeyListsItsBucket(t *testing.T) {
+	cfg := &config.AuthConfig{
+		Enabled: true,
+		Keys: []config.APIKey{
+			{Name: "images", Key: "images-key", Scopes: []string{ScopeList}, Buckets: []string{"Images"}},
+		},
+	}
+	// 挂载表：/Images 和 /media/img 对应存储桶 Images，其他路径位于默认存储
+	bucketOf := func(prefix string) string {
+		for _, p := range []string{"Images", "media/img"} {
+			if prefix == p || strings.HasPrefix(prefix, p+"/") {
+				return "Images"
+			}
+		}
+		return ""
+	}
+	m := NewAuthMiddleware(cfg, &config.LogConfig{}, bucketOf)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cases := map[string]int{
+		"/api/files/Images/":        http.StatusOK,
+		"/api/files/Images/photos/": http.StatusOK,
+		"/api/files/media/img/":     http.StatusOK,
+		"/api/files/docs/":          http.StatusForbidden,
+		"/api/files/ImagesPrivate/": http.StatusForbidden,
+	}
+	for target, want := range cases {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer images-key")
+		w := httptest.NewRecorder()
+		m.Middleware(next).ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("GET %s = %d，期望 %d", target, w.Code, want)
+		}
+	}
+}
+
+func TestPrefixKeyOnSyncEndpoints(t *testing.T) {
+	cfg := &config.AuthConfig{
+		Enabled: true,
+		Keys: []config.APIKey{
+			{Name: "docs-admin", Key: "admin-key", Scopes: []string{ScopeAdmin}, Prefixes: []string{"docs"}},
+			{Name: "docs-reader", Key: "read-key", Scopes: []string{ScopeRead}, Prefixes: []string{"docs/"}},
+			{Name: "images", Key: "bucket-key", Scopes: []string{ScopeAdmin}, Buckets: []string{"Images"}},
+		},
+	}
+	m := NewAuthMiddleware(cfg, &config.LogConfig{}, nil)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cases := []struct {
+		key, method, target string
+		want                int
+	}{
+		{"admin-key", http.MethodPost, "/api/files/sync/docs/run", http.StatusOK},
+		{"admin-key", http.MethodPost, "/api/files/sync/docs/api/cancel", http.StatusOK},
+		{"admin-key", http.MethodPost, "/api/files/sync/docs/rollback", http.StatusOK},
+		{"admin-key", http.MethodPost, "/api/files/sync/blog/run", http.StatusForbidden},
+		{"admin-key", http.MethodPost, "/api/files/sync/docs-private/run", http.StatusForbidden},
+		{"read-key", http.MethodGet, "/api/files/sync/docs/versions", http.StatusOK},
+		{"read-key", http.MethodGet, "/api/files/sync/blog/versions", http.StatusForbidden},
+		{"read-key", http.MethodPost, "/api/files/sync/docs/run", http.StatusForbidden},
+		// 状态和事件流由处理函数按仓库过滤
+		{"read-key", http.MethodGet, "/api/files/sync/status", http.StatusOK},
+		{"read-key", http.MethodGet, "/api/files/sync/events", http.StatusOK},
+		// 只限定存储桶的密钥不能操作仓库
+		{"bucket-key", http.MethodPost, "/api/files/sync/docs/run", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, nil)
+		req.Header.Set("Authorization", "Bearer "+c.key)
+		w := httptest.NewRecorder()
+		m.Middleware(next).ServeHTTP(w, req)
+		if w.Code != c.want {
+			t.Errorf("%s %s %s = %d，期望 %d", c.key, c.method, c.target, w.Code, c.want)
+		}
+	}
+}
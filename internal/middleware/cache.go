@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -9,6 +10,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -39,14 +41,30 @@ func NewCacheMiddleware(config *config.CacheConfig) (*CacheMiddleware, error) {
 	return cm, nil
 }
 
-// 生成缓存键
+// 生成缓存键，不同站点的相同路径对应不同的内容
 func (cm *CacheMiddleware) generateCacheKey(r *http.Request) string {
 	h := sha256.New()
+	if site := SiteFromContext(r.Context()); site != nil && len(site.Hosts) > 0 {
+		io.WriteString(h, site.Hosts[0]+"\x00")
+	}
 	io.WriteString(h, r.URL.Path)
 	io.WriteString(h, r.URL.RawQuery)
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// 站点的 Cache-Control：时间间隔转换为 max-age，其他值原样使用；
+// store 为 false 表示站点不允许服务端缓存
+func siteCacheControl(site *config.Site) (value string, store bool) {
+	if site == nil || site.CacheControl == "" {
+		return "", true
+	}
+	if duration, err := parseDuration(site.CacheControl); err == nil {
+		return fmt.Sprintf("public, max-age=%d", int(duration.Seconds())), true
+	}
+	lower := strings.ToLower(site.CacheControl)
+	return site.CacheControl, !strings.Contains(lower, "no-cache") && !strings.Contains(lower, "no-store") && !strings.Contains(lower, "private")
+}
+
 // 获取缓存文件路径
 func (cm *CacheMiddleware) getCachePath(key string) string {
 	return filepath.Join(cm.config.Directory, key)
@@ -116,13 +134,18 @@ func (cm *CacheMiddleware) shouldCache(path string) bool {
 
 func (cm *CacheMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siteControl, siteStore := siteCacheControl(SiteFromContext(r.Context()))
+		if siteControl != "" {
+			w.Header().Set("Cache-Control", siteControl)
+		}
+
 		if !cm.config.Enabled {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		// 检查是否应该缓存这个请求
-		if !cm.shouldCache(r.URL.Path) {
+		// 检查是否应该缓存这个请求（仅缓存 GET 请求，同步相关接口的内容随时变化，始终跳过）
+		if r.Method != http.MethodGet || strings.HasPrefix(r.URL.Path, "/api/files/sync/") || !siteStore || !cm.shouldCache(r.URL.Path) {
 			if cm.config.CacheLog {
 				log.Printf("Skip caching for path: %s", r.URL.Path)
 			}
@@ -144,7 +167,9 @@ func (cm *CacheMiddleware) Middleware(next http.Handler) http.Handler {
 			}
 
 			// 添加缓存控制头
-			if isAPIRequest {
+			if siteControl != "" {
+				w.Header().Set("Cache-Control", siteControl)
+			} else if isAPIRequest {
 				if duration, err := parseDuration(cm.config.APICacheControl); err == nil {
 					w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(duration.Seconds())))
 				}
@@ -157,7 +182,10 @@ func (cm *CacheMiddleware) Middleware(next http.Handler) http.Handler {
 			if cm.config.HitLog {
 				log.Printf("Cache hit: %s", r.URL.Path)
 			}
-			w.Write(content)
+
+			// 通过 ServeContent 输出，使缓存命中时同样支持 Range 和条件请求
+			modTime, _ := http.ParseTime(headers["Last-Modified"])
+			http.ServeContent(w, r, path.Base(r.URL.Path), modTime, bytes.NewReader(content))
 			return
 		}
 
@@ -22,6 +22,10 @@ type CliFlags struct {
 	ClearCache bool   // 新增：清除缓存目录
 	ClearAll   bool   // 新增：清除所有
 	RSync      string // 新增：指定要同步的仓库路径
+
+	DryRun           bool // 新增：仅显示计划上传和删除的文件
+	ConfirmDeletions bool // 新增：确认超过删除限制的同步
+	Restamp          bool // 新增：重新设置已上传文件的 Content-Type
 }
 
 func ParseFlags() *CliFlags {
@@ -39,6 +43,9 @@ func ParseFlags() *CliFlags {
 	flag.BoolVar(&flags.ClearCache, "cc", false, "清除所有缓存")
 	flag.BoolVar(&flags.ClearAll, "clear-all", false, "清除所有日志和缓存")
 	flag.StringVar(&flags.RSync, "rsync", "", "指定同步的仓库（使用配置中的 minioPath）")
+	flag.BoolVar(&flags.DryRun, "dry-run", false, "仅显示计划上传和删除的文件，不修改存储")
+	flag.BoolVar(&flags.ConfirmDeletions, "confirm-deletions", false, "确认超过删除限制的同步")
+	flag.BoolVar(&flags.Restamp, "restamp", false, "按当前规则重新设置已上传文件的 Content-Type，不同步仓库")
 
 	flag.Usage = showHelp
 	flag.Parse()
@@ -57,6 +64,10 @@ func showHelp() {
   --skip               跳过首次同步，等待下一个检查周期
   --sync              执行单次同步检查后退出
   --rsync string      指定同步的仓库（例如：--rsync=static）
+  --dry-run           与 --sync/--rsync 一起使用，仅显示计划上传和删除的文件
+  --confirm-deletions 与 --sync/--rsync 一起使用，确认超过删除限制的同步
+  --restamp           与 --sync/--rsync 一起使用，重新设置已上传文件的 Content-Type 而不同步，
+                      可与 --dry-run 一起使用预览
   --zip-logs          压缩所有日志文件为zip格式
   --unzip-logs        解压所有zip格式的日志文件
   --clear-logs, -cl   清除所有日志文件
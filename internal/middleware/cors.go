@@ -22,11 +22,17 @@ func (m *CORSMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
 
+		// 站点配置了允许的域名时使用站点的配置
+		allowedOrigins := m.allowedOrigins
+		if site := SiteFromContext(r.Context()); site != nil && len(site.AllowOrigins) > 0 {
+			allowedOrigins = site.AllowOrigins
+		}
+
 		// 检查是否允许该源
 		allowOrigin := "*"
 		if origin != "" {
 			allowed := false
-			for _, allowedOrigin := range m.allowedOrigins {
+			for _, allowedOrigin := range allowedOrigins {
 				if allowedOrigin == "*" || allowedOrigin == origin {
 					allowed = true
 					allowOrigin = origin
@@ -41,8 +47,8 @@ func (m *CORSMiddleware) Middleware(next http.Handler) http.Handler {
 
 		// 设置 CORS 头
 		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
 		w.Header().Set("Access-Control-Max-Age", "3600")
 
 		// 处理预检请求
@@ -3,10 +3,12 @@ package middleware
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
 	"sync"
 	"time"
 
@@ -15,17 +17,17 @@ import (
 )
 
 type ExternalURLMiddleware struct {
-	minioService *service.MinioService
-	config       *config.Config
-	client       *http.Client
+	storage service.Storage
+	config  *config.Config
+	client  *http.Client
 	sync.RWMutex
 	lastCheck map[string]time.Time
 }
 
-func NewExternalURLMiddleware(minioService *service.MinioService, config *config.Config) *ExternalURLMiddleware {
+func NewExternalURLMiddleware(storage service.Storage, config *config.Config) *ExternalURLMiddleware {
 	return &ExternalURLMiddleware{
-		minioService: minioService,
-		config:       config,
+		storage: storage,
+		config:  config,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -114,12 +116,16 @@ func (m *ExternalURLMiddleware) Middleware(next http.Handler) http.Handler {
 				log.Printf("下载失败 %s: %v", matchedURL.Path, err)
 			} else {
 				// 修改：使用正确的 Minio PutObject 选项
-				_, err = m.minioService.PutObject(
+				_, err = m.storage.Put(
+					r.Context(),
+					"",
 					matchedURL.MinioPath,
 					bytes.NewReader(data),
 					int64(len(data)),
-					map[string]string{
-						"X-Amz-Meta-Cache-Control": matchedURL.CacheControl, // 修改：添加 X-Amz-Meta- 前缀
+					service.PutOptions{
+						Metadata: map[string]string{
+							"X-Amz-Meta-Cache-Control": matchedURL.CacheControl, // 修改：添加 X-Amz-Meta- 前缀
+						},
 					},
 				)
 				if err != nil {
@@ -130,28 +136,24 @@ func (m *ExternalURLMiddleware) Middleware(next http.Handler) http.Handler {
 			}
 		}
 
-		// 从Minio获取文件并返回
-		obj, err := m.minioService.GetObject(matchedURL.MinioPath)
-		if err != nil {
-			http.Error(w, "文件不存在", http.StatusNotFound)
-			return
-		}
-		defer obj.Close()
-
-		// 获取文件信息
-		info, err := obj.Stat()
+		// 从存储获取文件并返回
+		obj, err := m.storage.Get(r.Context(), "", matchedURL.MinioPath)
 		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				http.Error(w, "文件不存在", http.StatusNotFound)
+				return
+			}
+			log.Printf("获取文件失败 %s: %v", matchedURL.MinioPath, err)
 			http.Error(w, "获取文件信息失败", http.StatusInternalServerError)
 			return
 		}
+		defer obj.Close()
 
 		// 设置响应头
-		w.Header().Set("Content-Type", info.ContentType)
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size))
 		w.Header().Set("Cache-Control", matchedURL.CacheControl)
 
-		// 输出文件内容
-		io.Copy(w, obj)
+		// 输出文件内容（支持 Range 和条件请求）
+		ServeObject(w, r, matchedURL.MinioPath, obj, obj.Info())
 	})
 }
 
@@ -168,12 +170,16 @@ func (m *ExternalURLMiddleware) Init() {
 					log.Printf("初始化外部URL失败 %s: %v", url.Path, err)
 					return
 				}
-				_, err = m.minioService.PutObject(
+				_, err = m.storage.Put(
+					context.Background(),
+					"",
 					url.MinioPath,
 					bytes.NewReader(data),
 					int64(len(data)),
-					map[string]string{
-						"X-Amz-Meta-Cache-Control": url.CacheControl,
+					service.PutOptions{
+						Metadata: map[string]string{
+							"X-Amz-Meta-Cache-Control": url.CacheControl,
+						},
 					},
 				)
 				if err != nil {
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"pysio.online/Files-API/internal/service"
+)
+
+// ServeObject 输出对象内容，支持 Range 请求（206/416）以及
+// If-None-Match、If-Modified-Since 等条件请求（304）
+// content 需要支持 Seek，存储后端返回的 service.Object 可直接传入
+func ServeObject(w http.ResponseWriter, r *http.Request, name string, content io.ReadSeeker, info service.ObjectInfo) {
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	if etag := formatETag(info.ETag); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	// ServeContent 负责 Last-Modified、条件请求判断以及单/多区间响应
+	http.ServeContent(w, r, name, info.LastModified, content)
+}
+
+// 将存储后端返回的 ETag 规范为带引号的强校验格式
+func formatETag(etag string) string {
+	etag = strings.Trim(etag, `"`)
+	if etag == "" {
+		return ""
+	}
+	return `"` + etag + `"`
+}
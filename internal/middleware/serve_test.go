@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pysio.online/Files-API/internal/config"
+	"pysio.online/Files-API/internal/service"
+)
+
+func TestServeObjectRangeAndConditionalRequests(t *testing.T) {
+	const body = "0123456789"
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	info := service.ObjectInfo{ETag: "abc", LastModified: modified, ContentType: "text/plain"}
+
+	backendHits := 0
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendHits++
+		ServeObject(w, r, "a.txt", strings.NewReader(body), info)
+	})
+	cache, err := NewCacheMiddleware(&config.CacheConfig{Enabled: true, Directory: t.TempDir(), CacheControl: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := cache.Middleware(backend)
+
+	// 先请求一次写入缓存，之后的请求都应命中缓存
+	w := httptest.NewRecorder()
+	cached.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/a.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != body {
+		t.Fatalf("首次请求返回 %d %q", w.Code, w.Body.String())
+	}
+	backendHits = 0
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		code    int
+		body    string
+	}{
+		{"完整内容", nil, http.StatusOK, body},
+		{"区间", map[string]string{"Range": "bytes=2-5"}, http.StatusPartialContent, "2345"},
+		{"后缀区间", map[string]string{"Range": "bytes=-3"}, http.StatusPartialContent, "789"},
+		{"无效区间", map[string]string{"Range": "bytes=20-30"}, http.StatusRequestedRangeNotSatisfiable, ""},
+		{"ETag 匹配", map[string]string{"If-None-Match": `"abc"`}, http.StatusNotModified, ""},
+		{"ETag 不匹配", map[string]string{"If-None-Match": `"other"`}, http.StatusOK, body},
+		{"未修改", map[string]string{"If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat)}, http.StatusNotModified, ""},
+		{"已修改", map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK, body},
+		{"If-Range 不匹配时返回完整内容", map[string]string{"Range": "bytes=0-1", "If-Range": `"other"`}, http.StatusOK, body},
+	}
+	for _, handler := range []struct {
+		name string
+		h    http.Handler
+	}{{"ServeObject", backend}, {"缓存命中", cached}} {
+		for _, c := range cases {
+			req := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+			for k, v := range c.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.h.ServeHTTP(w, req)
+			if w.Code != c.code {
+				t.Errorf("%s %s: 状态码 %d，期望 %d", handler.name, c.name, w.Code, c.code)
+			}
+			if c.code != http.StatusRequestedRangeNotSatisfiable && w.Body.String() != c.body {
+				t.Errorf("%s %s: 内容 %q，期望 %q", handler.name, c.name, w.Body.String(), c.body)
+			}
+			if c.code != http.StatusRequestedRangeNotSatisfiable && w.Header().Get("ETag") != `"abc"` {
+				t.Errorf("%s %s: ETag 为 %q", handler.name, c.name, w.Header().Get("ETag"))
+			}
+		}
+	}
+	if backendHits != len(cases) {
+		t.Errorf("后端被调用 %d 次，期望 %d 次（缓存命中的请求不应到达后端）", backendHits, len(cases))
+	}
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+type siteContextKey struct{}
+
+// SiteMiddleware 根据请求的域名匹配站点并写入请求上下文
+type SiteMiddleware struct {
+	sites          []config.Site
+	trustedProxies []*net.IPNet
+}
+
+// NewSiteMiddleware 创建站点中间件，trustedProxies 为可信反向代理的 IP 或 CIDR
+func NewSiteMiddleware(sites []config.Site, trustedProxies []string) (*SiteMiddleware, error) {
+	m := &SiteMiddleware{sites: sites}
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的可信代理地址 %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			m.trustedProxies = append(m.trustedProxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("无效的可信代理地址 %q: %v", proxy, err)
+		}
+		m.trustedProxies = append(m.trustedProxies, ipNet)
+	}
+	return m, nil
+}
+
+func (m *SiteMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(m.sites) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if site := m.Match(m.RequestHost(r)); site != nil {
+			r = r.WithContext(context.WithValue(r.Context(), siteContextKey{}, site))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Match 返回域名对应的站点：精确匹配优先，其次为最长的通配，最后为 "*"
+func (m *SiteMiddleware) Match(host string) *config.Site {
+	var matched *config.Site
+	best := -1
+	for i := range m.sites {
+		for _, pattern := range m.sites[i].Hosts {
+			pattern = strings.ToLower(strings.TrimSpace(pattern))
+			score := -1
+			switch {
+			case pattern == host:
+				return &m.sites[i]
+			case pattern == "*":
+				score = 0
+			case strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) && len(host) > len(pattern)-1:
+				score = len(pattern)
+			}
+			if score > best {
+				matched, best = &m.sites[i], score
+			}
+		}
+	}
+	return matched
+}
+
+// SiteFromContext 获取请求匹配的站点，未配置站点或没有匹配时返回 nil
+func SiteFromContext(ctx context.Context) *config.Site {
+	site, _ := ctx.Value(siteContextKey{}).(*config.Site)
+	return site
+}
+
+// RequestHost 请求的域名，去掉端口并转换为小写。
+// 只有来自可信反向代理的请求才使用 X-Forwarded-Host，否则客户端可以伪造域名选择其他站点
+func (m *SiteMiddleware) RequestHost(r *http.Request) string {
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" && m.fromTrustedProxy(r) {
+		// 多级代理时取第一个，即客户端请求的域名
+		host = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// fromTrustedProxy 请求的直接来源是否为可信的反向代理
+func (m *SiteMiddleware) fromTrustedProxy(r *http.Request) bool {
+	if len(m.trustedProxies) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range m.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
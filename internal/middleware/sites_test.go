@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+func TestRequestHostTrustsForwardedHostOnlyFromProxies(t *testing.T) {
+	m, err := NewSiteMiddleware(nil, []string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"10.1.2.3:4567", "admin.example.com"},
+		{"[::1]:4567", "admin.example.com"},
+		{"192.0.2.1:4567", "docs.example.com"},
+		{"11.0.0.1:4567", "docs.example.com"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = "Docs.Example.com:8080"
+		req.RemoteAddr = c.remoteAddr
+		req.Header.Set("X-Forwarded-Host", "admin.example.com, proxy.internal")
+		if got := m.RequestHost(req); got != c.want {
+			t.Errorf("来自 %s 的请求域名 = %q，期望 %q", c.remoteAddr, got, c.want)
+		}
+	}
+
+	// 未配置可信代理时始终使用 Host
+	m, err = NewSiteMiddleware([]config.Site{{Hosts: []string{"docs.example.com"}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "docs.example.com"
+	req.RemoteAddr = "10.1.2.3:4567"
+	req.Header.Set("X-Forwarded-Host", "admin.example.com")
+	if got := m.RequestHost(req); got != "docs.example.com" {
+		t.Errorf("请求域名 = %q，期望 docs.example.com", got)
+	}
+
+	if _, err := NewSiteMiddleware(nil, []string{"not-an-ip"}); err == nil {
+		t.Error("无效的可信代理地址应返回错误")
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+const (
+	defaultBuildTimeout = 10 * time.Minute
+	buildLogLimit       = 16 * 1024 // 同步状态中保留的构建输出字节数
+)
+
+// 在仓库目录中执行构建命令，输出逐行写入日志，report 为 true 时同时记录到同步状态
+func (m *SyncManager) build(ctx context.Context, repo *config.Repository, commit string, report bool) error {
+	cfg := repo.Build
+	root := filepath.Clean(filepath.Join(m.config.Git.CachePath, repo.LocalPath))
+	workDir, err := cleanRepoPath(cfg.WorkDir)
+	if err != nil {
+		return err
+	}
+	timeout := defaultBuildTimeout
+	if cfg.Timeout != "" {
+		if timeout, err = parseDurationCustom(cfg.Timeout); err != nil {
+			return fmt.Errorf("解析构建超时失败: %v", err)
+		}
+	}
+
+	// 清空上次的输出，避免源文件删除后旧的构建结果继续被发布
+	if cfg.Output != "" {
+		output, err := cleanRepoPath(cfg.Output)
+		if err != nil {
+			return err
+		}
+		if output == "" {
+			return fmt.Errorf("构建输出目录不能是仓库根目录")
+		}
+		if err := os.RemoveAll(filepath.Join(root, filepath.FromSlash(output))); err != nil {
+			return fmt.Errorf("清理构建输出目录失败: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", cfg.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", cfg.Command)
+	}
+	cmd.Dir = filepath.Join(root, filepath.FromSlash(workDir))
+	cmd.Env = append(os.Environ(), "FILES_API_COMMIT="+commit, "FILES_API_MINIO_PATH="+repo.MinioPath)
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	// 超时后构建命令启动的子进程可能仍持有输出管道，等待一段时间后强制结束
+	setBuildProcessGroup(cmd)
+	cmd.WaitDelay = 10 * time.Second
+
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	if report {
+		m.minioService.updateSyncStatus(repo.MinioPath, func(status *SyncStatus) {
+			status.Stage = "build"
+			status.BuildLog = ""
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var tail []byte
+		lines := bufio.NewReader(reader)
+		for {
+			line, err := lines.ReadString('\n')
+			if line != "" {
+				log.Printf("构建输出 %s: %s", repo.MinioPath, strings.TrimRight(line, "\r\n"))
+				if report {
+					if tail = append(tail, line...); len(tail) > buildLogLimit {
+						tail = tail[len(tail)-buildLogLimit:]
+					}
+					text := string(tail)
+					m.minioService.updateSyncStatus(repo.MinioPath, func(status *SyncStatus) {
+						status.BuildLog = text
+					})
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	log.Printf("开始构建 %s: %s", repo.MinioPath, cfg.Command)
+	started := time.Now()
+	err = cmd.Run()
+	writer.Close()
+	<-done
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("构建超时（%s），未发布", timeout)
+		}
+		return fmt.Errorf("构建失败，未发布: %v", err)
+	}
+	log.Printf("构建完成 %s，耗时 %s", repo.MinioPath, time.Since(started).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package service
+
+import "os/exec"
+
+// Windows 下只结束 cmd 进程，残留的子进程由 WaitDelay 兜底
+func setBuildProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+func TestCronNext(t *testing.T) {
+	// 2024-01-01 是周一
+	from := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"30 8 * * mon-fri", time.Date(2024, 1, 2, 8, 30, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, 1, 7, 12, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan,jul *", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		// 日和周都受限时满足其一即可：13 日或周五
+		{"0 0 13 * 5", time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+		// 以 * 开头的日字段不受限，需要同时满足：日期为奇数的周一
+		{"0 0 */2 * 1", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 ? * 1", time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)},
+		// 2 月 30 日不存在
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		cron, err := parseCron(c.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q) 失败: %v", c.expr, err)
+			continue
+		}
+		if got := cron.Next(from); !got.Equal(c.want) {
+			t.Errorf("%q 的下次执行时间 = %v，期望 %v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestParseCronRejectsInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"0 0 32 * *",
+		"0 0 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"* * * * mon-",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) 应返回错误", expr)
+		}
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Git.Jitter = "0s"
+	m := NewSyncManager(cfg, NewGitService(cfg), nil)
+	from := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	cases := map[string]time.Duration{
+		"":    10 * time.Minute,
+		"30m": 30 * time.Minute,
+		"1d":  24 * time.Hour,
+		"bad": 10 * time.Minute,
+		// 不大于 0 的间隔使用默认值，避免调度器空转
+		"0":   10 * time.Minute,
+		"0s":  10 * time.Minute,
+		"-1h": 10 * time.Minute,
+	}
+	for interval, want := range cases {
+		repo := &config.Repository{URL: "repo", CheckInterval: interval}
+		if got := m.nextRun(repo, nil, from); got.Sub(from) != want {
+			t.Errorf("checkInterval %q: 下次同步在 %v 之后，期望 %v", interval, got.Sub(from), want)
+		}
+	}
+
+	cron, err := parseCron("0 3 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &config.Repository{URL: "repo", CheckInterval: "1h"}
+	if got, want := m.nextRun(repo, cron, from), time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("cron 计划的下次同步 = %v，期望 %v", got, want)
+	}
+
+	// 未配置随机延迟时最多为间隔的 10%
+	cfg.Git.Jitter = ""
+	repo = &config.Repository{URL: "repo", CheckInterval: "30m"}
+	for i := 0; i < 20; i++ {
+		delay := m.nextRun(repo, nil, from).Sub(from) - 30*time.Minute
+		if delay < 0 || delay >= 3*time.Minute {
+			t.Fatalf("随机延迟 %v 超出范围 [0, 3m)", delay)
+		}
+	}
+}
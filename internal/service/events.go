@@ -0,0 +1,118 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// 同步事件类型
+const (
+	EventStatus = "status" // 同步状态变化
+	EventFile   = "file"   // 单个文件处理完成
+)
+
+// 每个订阅者的事件缓冲区大小，缓冲区满时丢弃新事件，避免拖慢同步
+const eventBufferSize = 256
+
+// SyncEvent 同步事件
+type SyncEvent struct {
+	Type      string      `json:"type"`
+	MinioPath string      `json:"minioPath"`
+	Time      time.Time   `json:"time"`
+	Status    *SyncStatus `json:"status,omitempty"` // status 事件：当前状态快照
+	File      *FileEvent  `json:"file,omitempty"`   // file 事件：文件处理结果
+}
+
+// FileEvent 单个文件的处理结果
+type FileEvent struct {
+	Path     string  `json:"path"`
+	Result   string  `json:"result"` // uploaded/skipped/deleted/failed
+	Error    string  `json:"error,omitempty"`
+	Progress float64 `json:"progress"`
+}
+
+// 同步事件的发布/订阅中心
+type eventHub struct {
+	mutex       sync.Mutex
+	subscribers map[chan SyncEvent]map[string]bool // 订阅者及其关注的 minioPath，为空表示全部
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan SyncEvent]map[string]bool)}
+}
+
+func (h *eventHub) subscribe(minioPaths []string) chan SyncEvent {
+	ch := make(chan SyncEvent, eventBufferSize)
+	filter := make(map[string]bool)
+	for _, p := range minioPaths {
+		filter[p] = true
+	}
+
+	h.mutex.Lock()
+	h.subscribers[ch] = filter
+	h.mutex.Unlock()
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan SyncEvent) {
+	h.mutex.Lock()
+	delete(h.subscribers, ch)
+	h.mutex.Unlock()
+}
+
+func (h *eventHub) publish(event SyncEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for ch, filter := range h.subscribers {
+		if len(filter) > 0 && !filter[event.MinioPath] {
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// SubscribeSyncEvents 订阅同步事件，minioPaths 为空时接收全部仓库的事件
+// 使用完毕后需调用返回的取消函数
+func (s *MinioService) SubscribeSyncEvents(minioPaths []string) (<-chan SyncEvent, func()) {
+	ch := s.events.subscribe(minioPaths)
+	return ch, func() { s.events.unsubscribe(ch) }
+}
+
+// 发布状态快照，调用方需持有 statusMutex
+func (s *MinioService) publishStatus(minioPath string, status *SyncStatus) {
+	copied := *status
+	s.events.publish(SyncEvent{
+		Type:      EventStatus,
+		MinioPath: minioPath,
+		Time:      time.Now(),
+		Status:    &copied,
+	})
+}
+
+// 发布单个文件的处理结果，调用方需持有 statusMutex
+func (s *MinioService) publishFile(minioPath, objectName string, outcome fileOutcome, err error, progress float64) {
+	event := &FileEvent{Path: objectName, Progress: progress}
+	switch outcome {
+	case fileUploaded:
+		event.Result = "uploaded"
+	case fileSkipped:
+		event.Result = "skipped"
+	case fileDeleted:
+		event.Result = "deleted"
+	case fileFailed:
+		event.Result = "failed"
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	s.events.publish(SyncEvent{
+		Type:      EventFile,
+		MinioPath: minioPath,
+		Time:      time.Now(),
+		File:      event,
+	})
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestEventHubDropsEventsWhenSubscriberIsFull(t *testing.T) {
+	hub := newEventHub()
+	slow := hub.subscribe(nil)
+	docs := hub.subscribe([]string{"docs"})
+
+	// 慢订阅者的缓冲区写满后丢弃新事件，发布不阻塞
+	for i := 0; i < eventBufferSize+10; i++ {
+		hub.publish(SyncEvent{Type: EventFile, MinioPath: "docs", File: &FileEvent{Path: strconv.Itoa(i)}})
+	}
+	hub.publish(SyncEvent{Type: EventStatus, MinioPath: "blog"})
+	if len(slow) != eventBufferSize || len(docs) != eventBufferSize {
+		t.Fatalf("缓冲区中有 %d 和 %d 个事件，期望均为 %d", len(slow), len(docs), eventBufferSize)
+	}
+	// 保留的是最早的事件
+	if first := <-slow; first.File.Path != "0" {
+		t.Errorf("第一个事件为 %s，期望 0", first.File.Path)
+	}
+
+	// 腾出空间后可以继续接收，过滤条件之外的仓库不会送达
+	hub.publish(SyncEvent{Type: EventStatus, MinioPath: "blog"})
+	if len(slow) != eventBufferSize || len(docs) != eventBufferSize {
+		t.Errorf("缓冲区中有 %d 和 %d 个事件，期望均为 %d", len(slow), len(docs), eventBufferSize)
+	}
+	for i := 0; i < eventBufferSize-1; i++ {
+		<-slow
+	}
+	if last := <-slow; last.MinioPath != "blog" {
+		t.Errorf("最后一个事件属于 %s，期望 blog", last.MinioPath)
+	}
+
+	// 取消订阅后不再接收事件
+	hub.unsubscribe(docs)
+	for len(docs) > 0 {
+		<-docs
+	}
+	hub.publish(SyncEvent{Type: EventStatus, MinioPath: "docs"})
+	if len(docs) != 0 {
+		t.Errorf("取消订阅后仍收到 %d 个事件", len(docs))
+	}
+}
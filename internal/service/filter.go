@@ -0,0 +1,221 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+// 仓库中的发布排除规则文件，位于发布根目录下，每行一个 glob，支持 # 注释和 ! 重新包含
+const ignoreFileName = ".filesapiignore"
+
+type globRule struct {
+	re     *regexp.Regexp
+	negate bool
+}
+
+// publishFilter 决定本地目录中哪些文件会被发布，路径均相对于发布根目录
+type publishFilter struct {
+	subPath string // 发布根目录相对于仓库根目录的路径
+	include []globRule
+	exclude []globRule // 按顺序匹配，最后一条匹配的规则生效
+	digest  string     // 规则摘要，未配置任何规则时为空
+}
+
+// 规范化仓库内的相对路径，不能指向仓库之外
+func cleanRepoPath(p string) (string, error) {
+	clean := strings.Trim(path.Clean(strings.ReplaceAll(p, "\\", "/")), "/")
+	if clean == "." {
+		return "", nil
+	}
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("无效的路径: %s", p)
+	}
+	return clean, nil
+}
+
+// 仓库的 subPath
+func repoSubPath(repo *config.Repository) (string, error) {
+	return cleanRepoPath(repo.SubPath)
+}
+
+// 发布的根目录，配置了构建输出目录时为输出目录，否则为 subPath
+func publishSubPath(repo *config.Repository) (string, error) {
+	if repo.Build != nil && repo.Build.Output != "" {
+		return cleanRepoPath(repo.Build.Output)
+	}
+	return repoSubPath(repo)
+}
+
+// 将 glob 转换为正则：* 和 ? 不匹配 /，** 匹配任意层级；
+// 不含 / 的模式匹配任意层级的文件或目录名，含 / 的模式从发布根目录开始匹配，匹配目录时包含其下所有文件
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	pattern = strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("(^|/)")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					b.WriteString("(.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("(/|$)")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("无效的匹配模式 %q: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// 解析规则列表，跳过空行和注释，allowNegate 为 true 时 ! 开头的规则表示重新包含
+func parseRules(patterns []string, allowNegate bool) ([]globRule, error) {
+	var rules []globRule
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		rule := globRule{}
+		if allowNegate && strings.HasPrefix(pattern, "!") {
+			rule.negate = true
+			pattern = pattern[1:]
+		}
+		re, err := compileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		rule.re = re
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// 读取仓库的 subPath、include/exclude 和 .filesapiignore，返回发布根目录和过滤规则
+func (s *MinioService) publishRoot(localPath, minioPath string) (string, *publishFilter, error) {
+	fullPath, err := s.localRoot(localPath)
+	if err != nil {
+		return "", nil, err
+	}
+	filter := &publishFilter{}
+	repo := s.repository(minioPath)
+	if repo == nil {
+		return fullPath, filter, nil
+	}
+
+	if filter.subPath, err = publishSubPath(repo); err != nil {
+		return "", nil, err
+	}
+	if filter.subPath != "" {
+		fullPath = filepath.Join(fullPath, filepath.FromSlash(filter.subPath))
+		if info, err := os.Stat(fullPath); err != nil || !info.IsDir() {
+			return "", nil, fmt.Errorf("仓库中不存在子目录 %s", filter.subPath)
+		}
+	}
+
+	ignore, err := os.ReadFile(filepath.Join(fullPath, ignoreFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return "", nil, fmt.Errorf("读取 %s 失败: %v", ignoreFileName, err)
+	}
+	if filter.include, err = parseRules(repo.Include, false); err != nil {
+		return "", nil, err
+	}
+	exclude := append(append([]string{}, repo.Exclude...), strings.Split(string(ignore), "\n")...)
+	if filter.exclude, err = parseRules(exclude, true); err != nil {
+		return "", nil, err
+	}
+
+	if filter.subPath != "" || len(repo.Include) > 0 || len(repo.Exclude) > 0 || len(ignore) > 0 {
+		h := sha1.New()
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00", filter.subPath, strings.Join(repo.Include, "\n"), strings.Join(repo.Exclude, "\n"))
+		h.Write(ignore)
+		filter.digest = hex.EncodeToString(h.Sum(nil))
+	}
+	return fullPath, filter, nil
+}
+
+// 文件是否发布，rel 为相对于发布根目录的路径
+func (f *publishFilter) allowed(rel string) bool {
+	if rel == ignoreFileName {
+		return false
+	}
+	if len(f.include) > 0 {
+		included := false
+		for _, rule := range f.include {
+			if rule.re.MatchString(rel) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	excluded := false
+	for _, rule := range f.exclude {
+		if rule.re.MatchString(rel) {
+			excluded = !rule.negate
+		}
+	}
+	return !excluded
+}
+
+// 将相对于仓库根目录的路径转换为相对于发布根目录的路径，不在 subPath 下时返回 false
+func (f *publishFilter) relative(repoPath string) (string, bool) {
+	if f.subPath == "" {
+		return repoPath, true
+	}
+	rel := strings.TrimPrefix(repoPath, f.subPath+"/")
+	return rel, rel != repoPath
+}
+
+// 变更是否需要发布：在 subPath 下且未被规则排除
+func (f *publishFilter) published(repoPath string) (string, bool) {
+	rel, ok := f.relative(repoPath)
+	return rel, ok && f.allowed(rel)
+}
@@ -0,0 +1,56 @@
+package service
+
+import "testing"
+
+func TestCleanRepoPathRejectsTraversal(t *testing.T) {
+	valid := map[string]string{
+		"":              "",
+		".":             "",
+		"/docs/":        "docs",
+		"docs/./site":   "docs/site",
+		"docs/../site":  "site",
+		`docs\site`:     "docs/site",
+		"a/b/../../c/d": "c/d",
+	}
+	for input, want := range valid {
+		got, err := cleanRepoPath(input)
+		if err != nil || got != want {
+			t.Errorf("cleanRepoPath(%q) = %q, %v，期望 %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"..", "../evil", "pkg/../../evil", `..\evil`} {
+		if got, err := cleanRepoPath(input); err == nil {
+			t.Errorf("cleanRepoPath(%q) = %q，期望返回错误", input, got)
+		}
+	}
+}
+
+func TestPublishFilterGlobs(t *testing.T) {
+	include, err := parseRules([]string{"dist/**", "*.md"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exclude, err := parseRules([]string{"# 注释", "*.map", "!keep.map", "dist/private/"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &publishFilter{include: include, exclude: exclude}
+
+	cases := map[string]bool{
+		"dist/index.html":        true,
+		"dist/js/app.js":         true,
+		"dist/js/app.js.map":     false,
+		"dist/js/keep.map":       true,
+		"dist/private/secret":    false,
+		"README.md":              true,
+		"docs/guide.md":          true,
+		"src/main.go":            false,
+		ignoreFileName:           false,
+		"dist/" + ignoreFileName: true,
+	}
+	for rel, want := range cases {
+		if got := f.allowed(rel); got != want {
+			t.Errorf("allowed(%q) = %v，期望 %v", rel, got, want)
+		}
+	}
+}
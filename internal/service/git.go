@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -21,14 +22,28 @@ func NewGitService(config *config.Config) *GitService {
 	return &GitService{config: config}
 }
 
-func (s *GitService) SyncRepository(repo *config.Repository) error {
+// SyncResult 仓库同步结果
+type SyncResult struct {
+	PreviousCommit string // 同步前本地的提交，首次克隆时为空
+	Commit         string // 同步后的提交
+}
+
+// FileChange 两次提交之间的文件变更
+type FileChange struct {
+	Status  byte   // 变更类型：A 新增、M 修改、D 删除、R 重命名、C 复制、T 类型变化
+	Path    string // 变更后的路径（相对仓库根目录）
+	OldPath string // 重命名前的路径
+}
+
+// SyncRepository 克隆或更新仓库，ctx 取消时终止 git 进程
+func (s *GitService) SyncRepository(ctx context.Context, repo *config.Repository) (*SyncResult, error) {
 	// 构建完整本地路径
 	localPath := filepath.Join(s.config.Git.CachePath, repo.LocalPath)
 	localPath = filepath.Clean(localPath)
 
 	// 创建目录并设置权限
 	if err := os.MkdirAll(localPath, 0755); err != nil {
-		return fmt.Errorf("创建本地目录失败 %s: %v", localPath, err)
+		return nil, fmt.Errorf("创建本地目录失败 %s: %v", localPath, err)
 	}
 
 	// 在克隆/拉取后修复权限
@@ -48,25 +63,216 @@ func (s *GitService) SyncRepository(repo *config.Repository) error {
 
 	// 确保缓存目录存在
 	if err := os.MkdirAll(s.config.Git.CachePath, 0755); err != nil {
-		return fmt.Errorf("创建缓存目录失败: %v", err)
+		return nil, fmt.Errorf("创建缓存目录失败: %v", err)
+	}
+
+	// 私有仓库的凭据只在访问远程仓库的命令中注入
+	auth, err := prepareGitAuth(repo)
+	if err != nil {
+		return nil, err
+	}
+	defer auth.cleanup()
+	// LFS 对象在检出后通过 PullLFS 统一拉取，避免检出时的 smudge 过滤器在没有凭据的情况下访问远程
+	if repo.LFS {
+		auth.env = append(auth.env, "GIT_LFS_SKIP_SMUDGE=1")
 	}
 
-	if _, err := os.Stat(localPath); os.IsNotExist(err) {
+	result := &SyncResult{}
+	_, statErr := os.Stat(filepath.Join(localPath, ".git"))
+	if os.IsNotExist(statErr) && repo.Commit == "" && !repo.SparseCheckout {
 		log.Printf("浅克隆仓库到: %s", localPath)
 		// 浅克隆，仅拉取最新提交
-		cmd := exec.Command("git", "clone", "--depth", "1", "-b", repo.Branch, repo.URL, localPath)
-		return cmd.Run()
+		if err := auth.run(ctx, "", "clone", "--depth", "1", "-b", checkoutRef(repo), repo.URL, localPath); err != nil {
+			return nil, err
+		}
+	} else {
+		if os.IsNotExist(statErr) {
+			// 固定提交无法通过 clone -b 拉取，稀疏检出需要在检出前设置，先初始化空仓库
+			log.Printf("初始化仓库: %s", localPath)
+			if err := exec.CommandContext(ctx, "git", "init", "-q", localPath).Run(); err != nil {
+				return nil, fmt.Errorf("初始化仓库失败: %v", err)
+			}
+			if err := exec.CommandContext(ctx, "git", "-C", localPath, "remote", "add", "origin", repo.URL).Run(); err != nil {
+				return nil, fmt.Errorf("添加远程仓库失败: %v", err)
+			}
+		} else {
+			result.PreviousCommit, _ = headCommit(ctx, localPath)
+			log.Printf("更新仓库: %s", localPath)
+		}
+		if err := sparseCheckout(ctx, repo, localPath); err != nil {
+			return nil, err
+		}
+
+		// 使用 fetch --depth 1 拉取最新提交
+		if err := auth.run(ctx, localPath, "fetch", "--depth", "1", "origin", fetchRef(repo)); err != nil {
+			return nil, err
+		}
+		// 使用 reset --hard 同步至拉取的版本
+		if err := auth.run(ctx, localPath, "reset", "-q", "--hard", "FETCH_HEAD"); err != nil {
+			return nil, err
+		}
 	}
 
-	log.Printf("更新仓库: %s", localPath)
-	// 使用 fetch --depth 1 拉取最新提交
-	cmd := exec.Command("git", "-C", localPath, "fetch", "--depth", "1", "origin", repo.Branch)
-	if err := cmd.Run(); err != nil {
+	commit, err := headCommit(ctx, localPath)
+	if err != nil {
+		return nil, fmt.Errorf("获取当前提交失败: %v", err)
+	}
+	result.Commit = commit
+	return result, nil
+}
+
+// UpdateSubmodules 递归初始化并浅拉取子模块，仓库的认证配置同样用于子模块
+func (s *GitService) UpdateSubmodules(ctx context.Context, repo *config.Repository) error {
+	localPath := filepath.Clean(filepath.Join(s.config.Git.CachePath, repo.LocalPath))
+	auth, err := prepareGitAuth(repo)
+	if err != nil {
+		return err
+	}
+	defer auth.cleanup()
+	if repo.LFS {
+		auth.env = append(auth.env, "GIT_LFS_SKIP_SMUDGE=1")
+	}
+
+	log.Printf("更新子模块: %s", localPath)
+	// 同步 .gitmodules 中可能变化的地址
+	if err := auth.run(ctx, localPath, "submodule", "sync", "--recursive"); err != nil {
+		return fmt.Errorf("更新子模块失败: %v", err)
+	}
+	if err := auth.run(ctx, localPath, "submodule", "update", "--init", "--recursive", "--force", "--depth", "1"); err != nil {
+		return fmt.Errorf("更新子模块失败: %v", err)
+	}
+	return nil
+}
+
+// PullLFS 拉取并检出当前提交的 LFS 对象，启用子模块时同样处理子模块
+func (s *GitService) PullLFS(ctx context.Context, repo *config.Repository) error {
+	localPath := filepath.Clean(filepath.Join(s.config.Git.CachePath, repo.LocalPath))
+	if err := exec.CommandContext(ctx, "git", "lfs", "version").Run(); err != nil {
+		return fmt.Errorf("拉取 LFS 对象失败: 未安装 git-lfs")
+	}
+	auth, err := prepareGitAuth(repo)
+	if err != nil {
 		return err
 	}
-	// 使用 reset --hard 同步至最新版本
-	cmd = exec.Command("git", "-C", localPath, "reset", "--hard", "origin/"+repo.Branch)
-	return cmd.Run()
+	defer auth.cleanup()
+
+	log.Printf("拉取 LFS 对象: %s", localPath)
+	if err := auth.run(ctx, localPath, "lfs", "pull"); err != nil {
+		return fmt.Errorf("拉取 LFS 对象失败: %v", err)
+	}
+	if repo.Submodules {
+		if err := auth.run(ctx, localPath, "submodule", "foreach", "--quiet", "--recursive", "git lfs pull"); err != nil {
+			return fmt.Errorf("拉取子模块 LFS 对象失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// 变更中是否包含子模块：子模块的变更在工作区中是目录
+func (s *GitService) hasSubmoduleChange(repo *config.Repository, changes []FileChange) bool {
+	localPath := filepath.Clean(filepath.Join(s.config.Git.CachePath, repo.LocalPath))
+	for _, change := range changes {
+		if info, err := os.Stat(filepath.Join(localPath, filepath.FromSlash(change.Path))); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// clone -b 使用的引用，固定标签时为标签名，否则为分支名
+func checkoutRef(repo *config.Repository) string {
+	if repo.Tag != "" {
+		return repo.Tag
+	}
+	return repo.Branch
+}
+
+// fetch 使用的引用，优先级为提交、标签、分支
+func fetchRef(repo *config.Repository) string {
+	switch {
+	case repo.Commit != "":
+		return repo.Commit
+	case repo.Tag != "":
+		return "refs/tags/" + repo.Tag
+	}
+	return repo.Branch
+}
+
+// 按配置启用稀疏检出，只检出 subPath；关闭配置后恢复完整检出
+func sparseCheckout(ctx context.Context, repo *config.Repository, localPath string) error {
+	if repo.SparseCheckout {
+		subPath, err := repoSubPath(repo)
+		if err != nil {
+			return err
+		}
+		if subPath != "" {
+			if err := exec.CommandContext(ctx, "git", "-C", localPath, "sparse-checkout", "set", subPath).Run(); err != nil {
+				return fmt.Errorf("设置稀疏检出失败: %v", err)
+			}
+			return nil
+		}
+	}
+	out, _ := exec.CommandContext(ctx, "git", "-C", localPath, "config", "--bool", "core.sparseCheckout").Output()
+	if strings.TrimSpace(string(out)) == "true" {
+		if err := exec.CommandContext(ctx, "git", "-C", localPath, "sparse-checkout", "disable").Run(); err != nil {
+			return fmt.Errorf("关闭稀疏检出失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// 获取仓库当前 HEAD 的提交 SHA
+func headCommit(ctx context.Context, localPath string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", "-C", localPath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ChangedFiles 返回两次提交之间变更的文件
+// 浅克隆可能缺少旧提交，此时返回错误，调用方应回退到全量同步
+func (s *GitService) ChangedFiles(ctx context.Context, repo *config.Repository, from, to string) ([]FileChange, error) {
+	localPath := filepath.Clean(filepath.Join(s.config.Git.CachePath, repo.LocalPath))
+
+	if err := exec.CommandContext(ctx, "git", "-C", localPath, "cat-file", "-e", from+"^{commit}").Run(); err != nil {
+		return nil, fmt.Errorf("提交 %s 在本地不可用", from)
+	}
+
+	out, err := exec.CommandContext(ctx, "git", "-C", localPath, "diff", "--name-status", "-z", "-M", from, to).Output()
+	if err != nil {
+		return nil, fmt.Errorf("获取变更列表失败: %v", err)
+	}
+	return parseNameStatus(out)
+}
+
+// 解析 git diff --name-status -z 的输出
+func parseNameStatus(out []byte) ([]FileChange, error) {
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	var changes []FileChange
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "" {
+			continue
+		}
+		change := FileChange{Status: fields[i][0]}
+		switch change.Status {
+		case 'R', 'C':
+			// 重命名和复制的状态后跟旧路径和新路径
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("无效的变更记录: %q", fields[i])
+			}
+			change.OldPath, change.Path = fields[i+1], fields[i+2]
+			i += 2
+		default:
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("无效的变更记录: %q", fields[i])
+			}
+			change.Path = fields[i+1]
+			i++
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
 }
 
 // 新增辅助函数：解析自定义时长
@@ -104,5 +310,10 @@ func (s *GitService) GetCheckInterval(repo *config.Repository) time.Duration {
 		log.Printf("解析仓库 %s 的检查间隔失败: %v, 使用默认值10分钟", repo.URL, err)
 		return 10 * time.Minute
 	}
+	// 间隔不大于 0 时调度器会不停地触发同步
+	if d <= 0 {
+		log.Printf("警告: 仓库 %s 的检查间隔 %s 无效, 使用默认值10分钟", repo.URL, repo.CheckInterval)
+		return 10 * time.Minute
+	}
 	return d
 }
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DeletionGuardError 计划删除的文件超过仓库配置的限制，同步在修改存储前中止
+type DeletionGuardError struct {
+	Planned int    // 计划删除的文件数
+	Total   int    // 当前已发布的文件数
+	Limit   string // 超过的限制
+}
+
+func (e *DeletionGuardError) Error() string {
+	return fmt.Sprintf("计划删除 %d/%d 个文件，超过限制 %s，需要确认后才能同步", e.Planned, e.Total, e.Limit)
+}
+
+type confirmDeletionsKey struct{}
+
+// ConfirmDeletions 返回允许超过删除限制的 ctx，用于确认被中止的同步
+func ConfirmDeletions(ctx context.Context) context.Context {
+	return context.WithValue(ctx, confirmDeletionsKey{}, true)
+}
+
+func deletionsConfirmed(ctx context.Context) bool {
+	confirmed, _ := ctx.Value(confirmDeletionsKey{}).(bool)
+	return confirmed
+}
+
+// 检查删除数量是否超过仓库的限制，返回超过的限制，未超过时返回空字符串；
+// remaining 为同步后仍发布的文件数。未配置限制时同样不允许把已发布的内容同步为空（如检出失败），
+// maxDeletePercent 设置为 100 时允许
+func (s *MinioService) deletionLimit(minioPath string, planned, total, remaining int) string {
+	repo := s.repository(minioPath)
+	if repo == nil || planned == 0 {
+		return ""
+	}
+	if total > 0 && remaining <= 0 && repo.MaxDeletePercent < 100 {
+		return "默认不允许删除全部已发布文件"
+	}
+	if repo.MaxDeletions > 0 && planned > repo.MaxDeletions {
+		return fmt.Sprintf("maxDeletions=%d", repo.MaxDeletions)
+	}
+	if repo.MaxDeletePercent > 0 && total > 0 && float64(planned)*100/float64(total) > repo.MaxDeletePercent {
+		return fmt.Sprintf("maxDeletePercent=%g", repo.MaxDeletePercent)
+	}
+	return ""
+}
+
+// 删除前检查限制，超过时记录等待确认的删除数量并返回 DeletionGuardError
+func (s *MinioService) checkDeletions(ctx context.Context, minioPath string, planned, total, remaining int) error {
+	limit := s.deletionLimit(minioPath, planned, total, remaining)
+	if limit == "" {
+		return nil
+	}
+	if deletionsConfirmed(ctx) {
+		log.Printf("已确认删除 %d/%d 个文件: %s", planned, total, minioPath)
+		return nil
+	}
+	log.Printf("计划删除 %d/%d 个文件，超过限制 %s，中止同步: %s", planned, total, limit, minioPath)
+	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.PendingDeletions = planned
+	})
+	return &DeletionGuardError{Planned: planned, Total: total, Limit: limit}
+}
+
+// 列出 prefix 下属于该仓库的文件，返回相对路径；
+// prefix 为 minioPath 本身时排除嵌套在其下的其他仓库
+func (s *MinioService) repoObjects(ctx context.Context, minioPath, prefix string) ([]string, error) {
+	objects, err := s.storage.List(ctx, "", prefix+"/")
+	if err != nil {
+		return nil, fmt.Errorf("获取文件列表失败: %v", err)
+	}
+	rels := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		if prefix == minioPath {
+			if owner, _, _ := s.splitRepoKey(obj.Key); owner != minioPath {
+				continue
+			}
+		}
+		rels = append(rels, strings.TrimPrefix(obj.Key, prefix+"/"))
+	}
+	return rels, nil
+}
+
+// SyncPlan 同步计划，列出与已发布内容相比需要上传和删除的文件
+type SyncPlan struct {
+	MinioPath string   `json:"minioPath"`
+	Commit    string   `json:"commit,omitempty"`
+	Uploads   []string `json:"uploads"`           // 新增或变更的文件
+	Deletions []string `json:"deletions"`         // 将被删除的文件
+	Unchanged int      `json:"unchanged"`         // 未变更的文件数
+	Total     int      `json:"total"`             // 当前已发布的文件数
+	Blocked   string   `json:"blocked,omitempty"` // 超过的删除限制，为空表示同步不会被中止
+}
+
+// PlanDirectory 比较本地目录和当前发布的内容，只读取存储，不做任何修改
+func (s *MinioService) PlanDirectory(ctx context.Context, localPath, minioPath string) (*SyncPlan, error) {
+	fullPath, filter, err := s.publishRoot(localPath, minioPath)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := s.localFiles(ctx, fullPath, minioPath, filter)
+	if err != nil {
+		return nil, err
+	}
+	live, err := s.livePrefix(minioPath)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.repoObjects(ctx, minioPath, live)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &SyncPlan{MinioPath: minioPath, Uploads: []string{}, Deletions: []string{}, Total: len(existing)}
+	local := make(map[string]bool, len(jobs))
+	var mutex sync.Mutex
+	var planErr error
+	for _, job := range jobs {
+		local[strings.TrimPrefix(job.objectName, minioPath+"/")] = true
+	}
+	s.runJobs(ctx, jobs, func(job fileJob) {
+		rel := strings.TrimPrefix(job.objectName, minioPath+"/")
+		sha1Hash, err := calculateSHA1(job.fullLocalPath)
+		unchanged := false
+		if err == nil {
+			info, statErr := s.storage.Stat(ctx, "", live+"/"+rel)
+			unchanged = statErr == nil && info.Metadata["Sha1"] == sha1Hash
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case err != nil:
+			planErr = fmt.Errorf("计算文件 %s SHA1失败: %v", job.objectName, err)
+		case unchanged:
+			plan.Unchanged++
+		default:
+			plan.Uploads = append(plan.Uploads, job.objectName)
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if planErr != nil {
+		return nil, planErr
+	}
+
+	for _, rel := range existing {
+		if !local[rel] {
+			plan.Deletions = append(plan.Deletions, minioPath+"/"+rel)
+		}
+	}
+	sort.Strings(plan.Uploads)
+	plan.Blocked = s.deletionLimit(minioPath, len(plan.Deletions), plan.Total, len(jobs))
+	return plan, nil
+}
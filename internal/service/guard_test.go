@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeletionLimitBlocksEmptyPublishByDefault(t *testing.T) {
+	s := newMemoryService(t, "docs")
+	repo := &s.config.Git.Repositories[0]
+
+	cases := []struct {
+		maxDeletions     int
+		maxDeletePercent float64
+		planned, total   int
+		remaining        int
+		blocked          bool
+	}{
+		{0, 0, 10, 10, 0, true},    // 默认：同步后没有任何文件
+		{0, 0, 1, 1, 1, false},     // 默认：重命名唯一的文件
+		{0, 0, 10, 10, 10, false},  // 默认：全部文件移动到子目录
+		{0, 0, 9, 10, 1, false},    // 默认：保留部分文件
+		{0, 0, 0, 0, 5, false},     // 首次发布
+		{0, 100, 10, 10, 0, false}, // 显式允许删除全部文件
+		{0, 50, 10, 10, 10, true},
+		{100, 0, 10, 10, 0, true},
+		{5, 0, 6, 100, 94, true},
+		{0, 30, 31, 100, 69, true},
+		{0, 30, 30, 100, 70, false},
+	}
+	for _, c := range cases {
+		repo.MaxDeletions, repo.MaxDeletePercent = c.maxDeletions, c.maxDeletePercent
+		limit := s.deletionLimit("docs", c.planned, c.total, c.remaining)
+		if (limit != "") != c.blocked {
+			t.Errorf("maxDeletions=%d maxDeletePercent=%g 删除 %d/%d 剩余 %d: 限制 %q，期望中止 %v",
+				c.maxDeletions, c.maxDeletePercent, c.planned, c.total, c.remaining, limit, c.blocked)
+		}
+	}
+}
+
+func TestUploadChangesAllowsRenamingOnlyFile(t *testing.T) {
+	s := newMemoryService(t, "docs")
+	s.config.Git.CachePath = t.TempDir()
+	putObject(t, s, "docs/index.html", "index")
+
+	repoDir := filepath.Join(s.config.Git.CachePath, "repo")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "home.html"), []byte("index"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes := []FileChange{{Status: 'R', OldPath: "index.html", Path: "home.html"}}
+	if err := s.UploadChanges(context.Background(), "repo", "docs", changes); err != nil {
+		t.Fatalf("重命名唯一的文件不应被删除保护中止: %v", err)
+	}
+	if _, err := s.storage.Stat(context.Background(), "", "docs/index.html"); err == nil {
+		t.Error("旧文件应被删除")
+	}
+}
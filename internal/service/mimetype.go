@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// 内置的扩展名表，优先于系统的 mime 表，保证不同系统上结果一致
+var builtinContentTypes = map[string]string{
+	".html":        "text/html",
+	".htm":         "text/html",
+	".css":         "text/css",
+	".js":          "text/javascript",
+	".mjs":         "text/javascript",
+	".cjs":         "text/javascript",
+	".json":        "application/json",
+	".map":         "application/json",
+	".webmanifest": "application/manifest+json",
+	".xml":         "application/xml",
+	".rss":         "application/rss+xml",
+	".atom":        "application/atom+xml",
+	".txt":         "text/plain",
+	".md":          "text/markdown",
+	".markdown":    "text/markdown",
+	".csv":         "text/csv",
+	".tsv":         "text/tab-separated-values",
+	".yaml":        "application/yaml",
+	".yml":         "application/yaml",
+	".toml":        "application/toml",
+	".ics":         "text/calendar",
+	".vtt":         "text/vtt",
+	".wasm":        "application/wasm",
+	".pdf":         "application/pdf",
+	".epub":        "application/epub+zip",
+
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".avif": "image/avif",
+	".svg":  "image/svg+xml",
+	".ico":  "image/x-icon",
+	".bmp":  "image/bmp",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".eot":   "application/vnd.ms-fontobject",
+
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".webm": "video/webm",
+	".ogv":  "video/ogg",
+	".mov":  "video/quicktime",
+	".m3u8": "application/vnd.apple.mpegurl",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+	".flac": "audio/flac",
+
+	".zip": "application/zip",
+	".gz":  "application/gzip",
+	".tgz": "application/gzip",
+	".tar": "application/x-tar",
+	".xz":  "application/x-xz",
+	".bz2": "application/x-bzip2",
+	".7z":  "application/x-7z-compressed",
+	".apk": "application/vnd.android.package-archive",
+	".exe": "application/vnd.microsoft.portable-executable",
+}
+
+// 嗅探内容类型时读取的字节数
+const sniffLen = 512
+
+// 辅助函数：根据文件扩展名获取 Content-Type
+func getContentType(filename string) string {
+	return detectContentType(filename, nil)
+}
+
+// 检测内容类型：overrides（按顺序）> 内置表 > 系统 mime 表 > 内容嗅探，
+// 文本类型没有 charset 时补充 charset=utf-8；head 为文件开头的内容，为空时不嗅探
+func detectContentType(name string, head []byte, overrides ...map[string]string) string {
+	ext := strings.ToLower(path.Ext(name))
+	contentType := ""
+	if ext != "" {
+		for _, table := range overrides {
+			if ct := lookupExt(table, ext); ct != "" {
+				contentType = ct
+				break
+			}
+		}
+		if contentType == "" {
+			contentType = builtinContentTypes[ext]
+		}
+		if contentType == "" {
+			contentType = mime.TypeByExtension(ext)
+		}
+	}
+	if contentType == "" && len(head) > 0 {
+		contentType = http.DetectContentType(head)
+	}
+	if contentType == "" {
+		return "application/octet-stream"
+	}
+	return withCharset(contentType)
+}
+
+// 覆盖表的键可以带或不带前导点，不区分大小写
+func lookupExt(table map[string]string, ext string) string {
+	if ct, ok := table[ext]; ok {
+		return ct
+	}
+	for k, ct := range table {
+		if strings.EqualFold(k, ext) || strings.EqualFold("."+k, ext) {
+			return ct
+		}
+	}
+	return ""
+}
+
+// 文本类型补充 charset=utf-8
+func withCharset(contentType string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["charset"] != "" {
+		return contentType
+	}
+	textual := strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") ||
+		mediaType == "application/json" || mediaType == "application/xml" ||
+		mediaType == "application/javascript" || mediaType == "application/yaml" || mediaType == "application/toml"
+	if !textual {
+		return contentType
+	}
+	params["charset"] = "utf-8"
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// 仓库的内容类型覆盖配置，仓库配置优先于全局配置
+func (s *MinioService) contentTypeOverrides(minioPath string) []map[string]string {
+	var overrides []map[string]string
+	if repo := s.repository(minioPath); repo != nil && len(repo.ContentTypes) > 0 {
+		overrides = append(overrides, repo.ContentTypes)
+	}
+	if len(s.config.ContentTypes) > 0 {
+		overrides = append(overrides, s.config.ContentTypes)
+	}
+	return overrides
+}
+
+// ContentTypeChange 一个对象的 Content-Type 修改
+type ContentTypeChange struct {
+	Key  string `json:"key"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RestampResult 重新设置 Content-Type 的结果
+type RestampResult struct {
+	Checked int                 `json:"checked"`
+	Updated int                 `json:"updated"`
+	Failed  int                 `json:"failed"`
+	Changes []ContentTypeChange `json:"changes"`
+}
+
+// RestampRepository 按当前规则重新设置仓库已上传文件的 Content-Type，包括原子发布的 release 目录；
+// dryRun 为 true 时只返回需要修改的文件
+func (s *MinioService) RestampRepository(ctx context.Context, minioPath string, dryRun bool) (*RestampResult, error) {
+	result := &RestampResult{Changes: []ContentTypeChange{}}
+	for _, prefix := range []string{minioPath + "/", releaseDir(minioPath) + "/"} {
+		objects, err := s.storage.List(ctx, "", prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objects {
+			// 嵌套在其下的其他仓库使用各自的配置
+			if prefix == minioPath+"/" {
+				if owner, _, _ := s.splitRepoKey(obj.Key); owner != minioPath {
+					continue
+				}
+			} else if strings.HasSuffix(obj.Key, "/active.json") {
+				continue
+			}
+			s.restampObject(ctx, "", obj, s.contentTypeOverrides(minioPath), dryRun, result)
+		}
+	}
+	return result, ctx.Err()
+}
+
+func (s *MinioService) restampObject(ctx context.Context, bucket string, obj ObjectInfo, overrides []map[string]string, dryRun bool, result *RestampResult) {
+	if ctx.Err() != nil {
+		return
+	}
+	result.Checked++
+	// 部分存储的列表不包含内容类型
+	if obj.ContentType == "" {
+		info, err := s.storage.Stat(ctx, bucket, obj.Key)
+		if err != nil {
+			log.Printf("获取文件信息失败 %s: %v", obj.Key, err)
+			result.Failed++
+			return
+		}
+		obj.ContentType = info.ContentType
+	}
+
+	contentType := detectContentType(obj.Key, nil, overrides...)
+	// 无法按扩展名识别时读取开头的内容嗅探
+	if contentType == "application/octet-stream" {
+		if object, err := s.storage.Get(ctx, bucket, obj.Key); err == nil {
+			head := make([]byte, sniffLen)
+			n, _ := io.ReadFull(object, head)
+			object.Close()
+			contentType = detectContentType(obj.Key, head[:n], overrides...)
+		}
+	}
+	if contentType == obj.ContentType {
+		return
+	}
+
+	result.Changes = append(result.Changes, ContentTypeChange{Key: obj.Key, From: obj.ContentType, To: contentType})
+	if dryRun {
+		return
+	}
+	if err := s.storage.SetContentType(ctx, bucket, obj.Key, contentType); err != nil {
+		log.Printf("设置 Content-Type 失败 %s: %v", obj.Key, err)
+		result.Failed++
+		return
+	}
+	result.Updated++
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -19,55 +20,112 @@ import (
 	"pysio.online/Files-API/internal/config"
 )
 
-// 辅助函数：根据文件扩展名获取 Content-Type
-func getContentType(filename string) string {
-	ext := strings.ToLower(filepath.Ext(filename))
-	switch ext {
-	case ".html", ".htm":
-		return "text/html"
-	case ".css":
-		return "text/css"
-	case ".js":
-		return "application/javascript"
-	case ".json":
-		return "application/json"
-	case ".png":
-		return "image/png"
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
-	case ".gif":
-		return "image/gif"
-	case ".pdf":
-		return "application/pdf"
-	case ".md":
-		return "text/markdown"
-	default:
-		return "application/octet-stream"
-	}
-}
-
 type MinioService struct {
 	client      *minio.Client
 	config      *config.Config
-	lastSync    map[string]time.Time     // 新增：记录每个仓库最后同步时间
-	syncMutex   sync.Mutex               // 新增：保护 lastSync map 的互斥锁
 	syncStatus  map[string]*SyncStatus   // 新增：同步状态追踪
 	statusMutex sync.RWMutex             // 新增：状态锁
 	buckets     map[string]*minio.Client // 新增多桶客户端映射
+	stateMutex  sync.Mutex               // 新增：保护状态文件写入
+	events      *eventHub                // 新增：同步事件订阅
+	storage     Storage                  // 新增：存储后端，使用 Minio 时为自身
+
+	manifests     map[string]map[string]string // 新增：同步过程中记录的文件清单，用于生成版本
+	manifestMutex sync.Mutex
+
+	releases     map[string]string // 新增：各仓库当前发布的 release，空字符串表示直接使用 minioPath
+	releaseMutex sync.RWMutex
+
+	presigned *presignCache // 新增：预签名URL缓存
 }
 
 // 新增：同步状态结构
 type SyncStatus struct {
-	LastSync     time.Time `json:"lastSync"`        // 最后同步时间
-	NextSync     time.Time `json:"nextSync"`        // 下次同步时间
-	Progress     float64   `json:"progress"`        // 同步进度(0-100)
-	TotalFiles   int       `json:"totalFiles"`      // 总文件数
-	CurrentFiles int       `json:"currentFiles"`    // 已处理文件数
-	Status       string    `json:"status"`          // 同步状态(idle/syncing/error)
-	Error        string    `json:"error,omitempty"` // 错误信息
+	LastSync     time.Time `json:"lastSync"`              // 最后同步时间
+	NextSync     time.Time `json:"nextSync"`              // 下次同步时间
+	Progress     float64   `json:"progress"`              // 同步进度(0-100)
+	TotalFiles   int       `json:"totalFiles"`            // 总文件数
+	CurrentFiles int       `json:"currentFiles"`          // 已处理文件数
+	Status       string    `json:"status"`                // 同步状态(idle/syncing/partial/error/cancelled)
+	Stage        string    `json:"stage,omitempty"`       // 同步中的阶段(fetch/submodules/lfs/build/upload)
+	Error        string    `json:"error,omitempty"`       // 错误信息
+	TriggeredBy  string    `json:"triggeredBy,omitempty"` // 触发来源(startup/schedule/webhook/api)
+	Commit       string    `json:"commit,omitempty"`      // 最后成功发布的提交
+	Version      string    `json:"version,omitempty"`     // 当前发布的版本
+	Release      string    `json:"release,omitempty"`     // 原子发布时当前的 release 目录
+	Filter       string    `json:"filter,omitempty"`      // 发布时使用的 subPath/include/exclude 规则摘要
+	// 回滚前发布的提交，该提交不会被定时和 Webhook 同步再次发布
+	RolledBackFrom string    `json:"rolledBackFrom,omitempty"`
+	LastSuccess    time.Time `json:"lastSuccess"` // 最后成功时间
+	LastFailure    time.Time `json:"lastFailure"` // 最后失败时间
+	DurationMs     int64     `json:"durationMs"`  // 最近一次同步耗时(毫秒)
+
+	// 最近一次同步的文件统计
+	Uploaded    int          `json:"uploaded"`              // 已上传
+	Skipped     int          `json:"skipped"`               // 未变更跳过
+	Deleted     int          `json:"deleted"`               // 已删除
+	Failed      int          `json:"failed"`                // 失败
+	FailedFiles []FailedFile `json:"failedFiles,omitempty"` // 最近失败的文件
+
+	PendingDeletions int    `json:"pendingDeletions,omitempty"` // 超过删除限制、等待确认的删除数量
+	BuildLog         string `json:"buildLog,omitempty"`         // 最近一次构建输出的末尾部分
+}
+
+// 同步失败的文件
+type FailedFile struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// SyncStatus 中保留的失败文件数量上限
+const maxFailedFiles = 20
+
+// 单个文件的同步结果
+type fileOutcome int
+
+const (
+	fileUploaded fileOutcome = iota
+	fileSkipped
+	fileDeleted
+	fileFailed
+)
+
+// PartialSyncError 部分文件在重试后仍同步失败
+type PartialSyncError struct {
+	Failed int
+}
+
+func (e *PartialSyncError) Error() string {
+	return fmt.Sprintf("%d 个文件同步失败", e.Failed)
 }
 
 func NewMinioService(config *config.Config) (*MinioService, error) {
+	s := &MinioService{
+		config:     config,
+		syncStatus: make(map[string]*SyncStatus),
+		events:     newEventHub(),
+		manifests:  make(map[string]map[string]string),
+		releases:   make(map[string]string),
+		presigned:  newPresignCache(),
+	}
+
+	// 本地和内存存储不需要 Minio 客户端
+	switch config.Storage.Driver {
+	case DriverLocal:
+		root := config.Storage.Path
+		if root == "" {
+			root = "data"
+		}
+		s.storage = NewLocalStorage(root)
+		return s, nil
+	case DriverMemory:
+		s.storage = NewMemoryStorage()
+		return s, nil
+	case "", DriverMinio:
+	default:
+		return nil, fmt.Errorf("不支持的存储驱动: %s", config.Storage.Driver)
+	}
+
 	client, err := minio.New(config.Minio.Endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(config.Minio.AccessKey, config.Minio.SecretKey, ""),
 		Secure: config.Minio.UseSSL,
@@ -89,16 +147,21 @@ func NewMinioService(config *config.Config) (*MinioService, error) {
 		buckets[bucketConfig.Name] = client
 	}
 
-	return &MinioService{
-		client:     client,
-		config:     config,
-		lastSync:   make(map[string]time.Time),
-		syncStatus: make(map[string]*SyncStatus),
-		buckets:    buckets,
-	}, nil
+	s.client = client
+	s.buckets = buckets
+	s.storage = s
+	return s, nil
+}
+
+// Storage 返回文件服务使用的存储后端，仓库路径按当前发布的 release 解析
+func (s *MinioService) Storage() Storage {
+	return &publishedStorage{Storage: s.storage, s: s}
 }
 
 func (s *MinioService) CheckConnection() error {
+	if s.client == nil {
+		return nil
+	}
 	// 检查bucket是否存在
 	exists, err := s.client.BucketExists(context.Background(), s.config.Minio.Bucket)
 	if err != nil {
@@ -130,7 +193,8 @@ func calculateSHA1(path string) (string, error) {
 }
 
 // 修改 SHA1 校验，统一使用元数据键 "Sha1"
-func (s *MinioService) needsUpdate(objectName, localPath string) (bool, error) {
+// 返回是否需要上传以及本地文件的 SHA1，避免上传前重复计算
+func (s *MinioService) needsUpdate(ctx context.Context, objectName, localPath string) (bool, string, error) {
 	// 处理路径分隔符
 	objectName = strings.ReplaceAll(objectName, string(os.PathSeparator), "/")
 	localPath = filepath.Clean(localPath)
@@ -138,34 +202,34 @@ func (s *MinioService) needsUpdate(objectName, localPath string) (bool, error) {
 	// 检查本地文件权限
 	if err := ensureFilePermissions(localPath); err != nil {
 		log.Printf("权限检查失败 %s: %v", localPath, err)
-		return false, err
+		return false, "", err
 	}
 
-	// 获取Minio对象的元数据
-	stat, err := s.client.StatObject(context.Background(), s.config.Minio.Bucket, objectName, minio.StatObjectOptions{})
+	// 获取本地文件SHA1
+	localSHA1, err := calculateSHA1(localPath)
 	if err != nil {
-		if err.Error() == "The specified key does not exist." {
-			return true, nil
-		}
-		return false, err
+		return false, "", err
 	}
 
-	// 获取本地文件SHA1
-	localSHA1, err := calculateSHA1(localPath)
+	// 获取已上传对象的元数据
+	stat, err := s.storage.Stat(ctx, "", objectName)
 	if err != nil {
-		return false, err
+		if errors.Is(err, os.ErrNotExist) {
+			return true, localSHA1, nil
+		}
+		return false, "", err
 	}
 
 	// 调试输出：打印远程所有元数据和本地SHA1
 	// log.Printf("检查文件: %s, localSHA1: %s, remote元数据: %+v", objectName, localSHA1, stat.UserMetadata)
 
 	// 使用 "Sha1" 键进行检查
-	remoteSHA1, ok := stat.UserMetadata["Sha1"]
+	remoteSHA1, ok := stat.Metadata["Sha1"]
 	if ok && remoteSHA1 == localSHA1 {
 		log.Printf("文件未改变, 跳过上传: %s", objectName)
-		return false, nil
+		return false, localSHA1, nil
 	}
-	return true, nil
+	return true, localSHA1, nil
 }
 
 // 存储远程文件列表
@@ -173,69 +237,6 @@ type MinioObjects struct {
 	Objects map[string]struct{}
 }
 
-// 获取Minio中指定路径下的所有文件
-func (s *MinioService) ListObjects(prefix string) ([]MinioObject, error) {
-	ctx := context.Background()
-	var objects []MinioObject
-
-	opts := minio.ListObjectsOptions{
-		Prefix:    prefix,
-		Recursive: true,
-	}
-
-	// 遍历 minio 对象列表，并构造返回列表
-	for object := range s.client.ListObjects(ctx, s.config.Minio.Bucket, opts) {
-		if object.Err != nil {
-			return nil, object.Err
-		}
-		objects = append(objects, MinioObject{
-			Key:          object.Key,
-			Size:         object.Size,
-			LastModified: object.LastModified,
-		})
-	}
-	return objects, nil
-}
-
-// 定义公开的 MinioObject 结构体，如未定义则添加
-type MinioObject struct {
-	Key          string
-	Size         int64
-	LastModified time.Time
-}
-
-// 删除Minio中的文件
-func (s *MinioService) removeObject(objectPath string) error {
-	return s.client.RemoveObject(context.Background(), s.config.Minio.Bucket, objectPath, minio.RemoveObjectOptions{})
-}
-
-// 检查是否需要同步
-func (s *MinioService) shouldSync(minioPath string, checkInterval time.Duration) bool {
-	s.syncMutex.Lock()
-	defer s.syncMutex.Unlock()
-
-	lastSync, exists := s.lastSync[minioPath]
-	if !exists {
-		s.lastSync[minioPath] = time.Now()
-		return true
-	}
-
-	if time.Since(lastSync) >= checkInterval {
-		s.lastSync[minioPath] = time.Now()
-		return true
-	}
-
-	return false
-}
-
-// 初始化最后同步时间
-func (s *MinioService) InitLastSync(minioPath string) {
-	s.syncMutex.Lock()
-	defer s.syncMutex.Unlock()
-	s.lastSync[minioPath] = time.Now()
-	log.Printf("初始化同步时间: %s", minioPath)
-}
-
 // 新增：更新同步状态
 func (s *MinioService) updateSyncStatus(minioPath string, update func(*SyncStatus)) {
 	s.statusMutex.Lock()
@@ -246,7 +247,22 @@ func (s *MinioService) updateSyncStatus(minioPath string, update func(*SyncStatu
 		status = &SyncStatus{Status: "idle"}
 		s.syncStatus[minioPath] = status
 	}
+	previous, stage := status.Status, status.Stage
 	update(status)
+	if status.Status != previous || status.Stage != stage {
+		s.publishStatus(minioPath, status)
+	}
+}
+
+// 获取最后成功发布的提交，用作增量同步的基准
+func (s *MinioService) publishedCommit(minioPath string) string {
+	s.statusMutex.RLock()
+	defer s.statusMutex.RUnlock()
+
+	if status, exists := s.syncStatus[minioPath]; exists {
+		return status.Commit
+	}
+	return ""
 }
 
 // 新增：获取同步状态
@@ -255,240 +271,399 @@ func (s *MinioService) GetSyncStatus(minioPath string) *SyncStatus {
 	defer s.statusMutex.RUnlock()
 
 	if status, exists := s.syncStatus[minioPath]; exists {
-		return status
+		// 返回副本，避免与同步过程并发读写
+		copied := *status
+		return &copied
 	}
 	return &SyncStatus{Status: "unknown"}
 }
 
-func (s *MinioService) UploadDirectory(localPath, minioPath string, checkInterval time.Duration) error {
-	// 更新同步开始状态
-	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
-		status.Status = "syncing"
-		status.Progress = 0
-		status.CurrentFiles = 0
-		status.Error = ""
-		status.LastSync = time.Now()
-		if checkInterval > 0 {
-			status.NextSync = time.Now().Add(checkInterval)
+// 待上传的文件
+type fileJob struct {
+	fullLocalPath string
+	objectName    string
+	size          int64
+}
+
+// 收集阶段已经失败的文件
+type failedJob struct {
+	objectName string
+	err        error
+}
+
+// UploadDirectory 将本地目录同步到 minioPath，ctx 取消时停止上传并跳过删除阶段；
+// 计划删除的文件超过仓库限制时在上传前中止
+func (s *MinioService) UploadDirectory(ctx context.Context, localPath, minioPath string) (err error) {
+	s.startSync(minioPath)
+	defer s.recoverSync(minioPath, &err)
+
+	log.Printf("开始同步目录: %s", minioPath)
+	fullPath, filter, err := s.publishRoot(localPath, minioPath)
+	if err != nil {
+		return err
+	}
+	s.beginManifest(minioPath, map[string]string{})
+
+	// 先收集所有待处理的文件
+	jobs, err := s.localFiles(ctx, fullPath, minioPath, filter)
+	if err != nil {
+		return s.finishCancelled(ctx, minioPath, err)
+	}
+
+	// 删除Minio中存在但本地不存在的文件，上传前确定并检查删除数量
+	existingObjects, err := s.repoObjects(ctx, minioPath, minioPath)
+	if err != nil {
+		return err
+	}
+	local := make(map[string]struct{}, len(jobs))
+	for _, job := range jobs {
+		local[job.objectName] = struct{}{}
+	}
+	var removals []string
+	for _, rel := range existingObjects {
+		objName := minioPath + "/" + rel
+		if _, exists := local[objName]; !exists {
+			removals = append(removals, objName)
 		}
+	}
+	if err := s.checkDeletions(ctx, minioPath, len(removals), len(existingObjects), len(jobs)); err != nil {
+		return err
+	}
+	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.TotalFiles = len(jobs) + len(removals)
 	})
 
-	defer func() {
-		if r := recover(); r != nil {
-			s.updateSyncStatus(minioPath, func(status *SyncStatus) {
-				status.Status = "error"
-				status.Error = fmt.Sprintf("panic: %v", r)
-			})
+	// 并发上传任务，使用工作池处理
+	s.runJobs(ctx, jobs, func(job fileJob) {
+		if s.config.Logs.ProcessLog {
+			log.Printf("Processing: %s -> %s", job.fullLocalPath, job.objectName)
 		}
-	}()
 
-	// 修改检查逻辑：当 checkInterval 为 0 时强制同步
-	if checkInterval > 0 && !s.shouldSync(minioPath, checkInterval) {
-		log.Printf("跳过同步，未到检查时间: %s", minioPath)
-		return nil
-	}
-
-	log.Printf("开始同步目录: %s, 间隔时间: %v", minioPath, checkInterval)
-	// 构建完整的本地路径
-	fullPath := filepath.Join(s.config.Git.CachePath, localPath)
-	fullPath = filepath.Clean(fullPath) // 清理路径
+		// 检查是否需要更新，同时得到本地文件的 SHA1
+		needsUpd, sha1Hash, err := s.needsUpdate(ctx, job.objectName, job.fullLocalPath)
+		if err != nil {
+			log.Printf("检查文件状态失败 %s: %v", job.objectName, err)
+			s.recordFile(minioPath, job.objectName, fileFailed, err)
+			return
+		}
+		if !needsUpd {
+			log.Printf("跳过未变更文件: %s", job.objectName)
+			s.trackObject(minioPath, job.objectName, sha1Hash)
+			s.recordFile(minioPath, job.objectName, fileSkipped, nil)
+			return
+		}
+		s.archiveObject(ctx, minioPath, job.objectName)
+		s.recordUpload(ctx, minioPath, job.objectName, sha1Hash, s.uploadFile(ctx, minioPath, job, sha1Hash))
+	})
 
-	// 确保目录存在并设置正确权限
-	if err := os.MkdirAll(fullPath, 0755); err != nil {
-		return fmt.Errorf("创建目录失败 %s: %v", fullPath, err)
+	if err := ctx.Err(); err != nil {
+		return s.finishCancelled(ctx, minioPath, err)
 	}
 
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		return fmt.Errorf("本地路径不存在: %s", fullPath)
+	if err := s.removeObjects(ctx, minioPath, removals); err != nil {
+		return s.finishCancelled(ctx, minioPath, err)
 	}
 
-	// 先收集所有待处理的文件
-	type fileJob struct {
-		fullLocalPath string
-		objectName    string
-		info          os.FileInfo
+	return s.finishSync(minioPath)
+}
+
+// UploadChanges 仅同步 git diff 中列出的变更，不再遍历整个目录
+func (s *MinioService) UploadChanges(ctx context.Context, localPath, minioPath string, changes []FileChange) (err error) {
+	s.startSync(minioPath)
+	defer s.recoverSync(minioPath, &err)
+
+	log.Printf("开始增量同步: %s, 变更文件 %d 个", minioPath, len(changes))
+	fullPath, filter, err := s.publishRoot(localPath, minioPath)
+	if err != nil {
+		return err
 	}
+	s.beginManifest(minioPath, s.activeManifest(ctx, minioPath))
+
 	var jobs []fileJob
-	err := filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
+	var removals []string
+	var statFailures []failedJob
+	for _, change := range changes {
+		if change.Status == 'R' {
+			if oldRel, ok := filter.published(change.OldPath); ok {
+				removals = append(removals, path.Join(minioPath, oldRel))
+			}
+		}
+		// subPath 之外和被排除的文件不发布
+		rel, ok := filter.published(change.Path)
+		if !ok {
+			continue
+		}
+		objName := path.Join(minioPath, rel)
+		if change.Status == 'D' {
+			removals = append(removals, objName)
+			continue
+		}
+
+		localFile := filepath.Join(fullPath, filepath.FromSlash(rel))
+		info, err := os.Stat(localFile)
 		if err != nil {
-			// 处理权限错误
-			if os.IsPermission(err) {
-				log.Printf("权限不足 %s: %v", path, err)
-				return nil // 跳过此文件但继续处理
+			if os.IsNotExist(err) {
+				removals = append(removals, objName)
+				continue
 			}
-			return err
+			// 无法读取的文件计为失败，同步以 partial 结束，下次重试
+			log.Printf("获取文件信息失败 %s: %v", localFile, err)
+			statFailures = append(statFailures, failedJob{objectName: objName, err: fmt.Errorf("获取文件信息失败: %v", err)})
+			continue
 		}
-		// 跳过目录和.git文件夹
+		// 子模块等目录类型的变更不上传
 		if info.IsDir() {
-			if info.Name() == ".git" {
-				return filepath.SkipDir
-			}
-			return nil
+			continue
 		}
-		relPath, err := filepath.Rel(fullPath, path)
+		jobs = append(jobs, fileJob{fullLocalPath: localFile, objectName: objName, size: info.Size()})
+	}
+	if len(removals) > 0 {
+		existing, err := s.repoObjects(ctx, minioPath, minioPath)
 		if err != nil {
 			return err
 		}
-		// 规范化对象名称
-		objName := filepath.Join(minioPath, relPath)
-		// 统一使用 / 作为路径分隔符
-		objName = strings.ReplaceAll(objName, string(os.PathSeparator), "/")
-		jobs = append(jobs, fileJob{fullLocalPath: path, objectName: objName, info: info})
-		return nil
+		// 同步后仍发布的文件：未删除的已有文件加上新增和变更的文件
+		remaining := len(existing) - len(removals) + len(jobs) + len(statFailures)
+		if err := s.checkDeletions(ctx, minioPath, len(removals), len(existing), remaining); err != nil {
+			return err
+		}
+	}
+	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.TotalFiles = len(jobs) + len(removals) + len(statFailures)
 	})
-	if err != nil {
-		return err
+	for _, failure := range statFailures {
+		s.recordFile(minioPath, failure.objectName, fileFailed, failure.err)
 	}
 
-	// 并发上传任务，使用工作池处理
-	processedFiles := make(map[string]struct{})
-	var pfMutex sync.Mutex
+	s.runJobs(ctx, jobs, func(job fileJob) {
+		if s.config.Logs.ProcessLog {
+			log.Printf("Processing: %s -> %s", job.fullLocalPath, job.objectName)
+		}
+		sha1Hash, err := calculateSHA1(job.fullLocalPath)
+		if err != nil {
+			log.Printf("计算文件 %s SHA1失败: %v", job.objectName, err)
+			s.recordFile(minioPath, job.objectName, fileFailed, err)
+			return
+		}
+		s.archiveObject(ctx, minioPath, job.objectName)
+		s.recordUpload(ctx, minioPath, job.objectName, sha1Hash, s.uploadFile(ctx, minioPath, job, sha1Hash))
+	})
 
-	// 使用配置的线程数，如果配置值小于1则使用默认值16
-	maxWorkers := s.config.Minio.MaxWorkers
-	if maxWorkers < 1 {
-		maxWorkers = 16
+	if err := ctx.Err(); err != nil {
+		return s.finishCancelled(ctx, minioPath, err)
 	}
 
-	jobChan := make(chan fileJob)
-	var wg sync.WaitGroup
-
-	worker := func() {
-		defer wg.Done()
-		for job := range jobChan {
-			if s.config.Logs.ProcessLog {
-				log.Printf("Processing: %s -> %s", job.fullLocalPath, job.objectName)
-			}
-			// 标记已处理文件
-			pfMutex.Lock()
-			processedFiles[job.objectName] = struct{}{}
-			pfMutex.Unlock()
-
-			// 检查是否需要更新
-			needsUpd, err := s.needsUpdate(job.objectName, job.fullLocalPath)
-			if err != nil {
-				log.Printf("检查文件状态失败 %s: %v", job.objectName, err)
-				continue
-			}
-			if !needsUpd {
-				log.Printf("跳过未变更文件: %s", job.objectName)
-				continue
-			}
-
-			// 计算 SHA1
-			sha1Hash, err := calculateSHA1(job.fullLocalPath)
-			if err != nil {
-				log.Printf("计算文件 %s SHA1失败: %v", job.objectName, err)
-				continue
-			}
+	if err := s.removeObjects(ctx, minioPath, removals); err != nil {
+		return s.finishCancelled(ctx, minioPath, err)
+	}
 
-			// 打开文件
-			file, err := os.Open(job.fullLocalPath)
-			if err != nil {
-				log.Printf("打开文件失败 %s: %v", job.objectName, err)
-				continue
-			}
+	return s.finishSync(minioPath)
+}
 
-			// 修改上传文件时设置的元数据键为 "Sha1"
-			userMetadata := map[string]string{
-				"Sha1": sha1Hash,
-			}
-			maxRetries := 3
-			var uploadErr error
-			for i := 0; i < maxRetries; i++ {
-				// 重置文件指针以便重传
-				if _, err := file.Seek(0, 0); err != nil {
-					log.Printf("重置文件指针失败 %s: %v", job.objectName, err)
-					break
-				}
-				_, uploadErr = s.client.PutObject(
-					context.Background(),
-					s.config.Minio.Bucket,
-					job.objectName,
-					file,
-					job.info.Size(),
-					minio.PutObjectOptions{
-						ContentType:  getContentType(job.fullLocalPath),
-						UserMetadata: userMetadata,
-					},
-				)
-				if uploadErr == nil {
-					log.Printf("成功上传文件: %s", job.objectName)
-					break
-				}
-				log.Printf("第%d次上传失败 %s: %v", i+1, job.objectName, uploadErr)
-				time.Sleep(2 * time.Second)
-			}
-			file.Close()
+// 删除对象并记录结果，ctx 取消时返回错误
+func (s *MinioService) removeObjects(ctx context.Context, minioPath string, objectNames []string) error {
+	for _, objName := range objectNames {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
+		log.Printf("删除已移除的文件: %s", objName)
+		s.archiveObject(ctx, minioPath, objName)
+		if err := s.storage.Remove(ctx, "", objName); err != nil {
+			log.Printf("删除文件失败 %s: %v", objName, err)
+			s.recordFile(minioPath, objName, fileFailed, err)
+			continue
+		}
+		s.trackObject(minioPath, objName, "")
+		s.recordFile(minioPath, objName, fileDeleted, nil)
 	}
+	return nil
+}
 
-	wg.Add(maxWorkers)
-	for i := 0; i < maxWorkers; i++ {
-		go worker()
-	}
-	// 发送任务
-	for _, job := range jobs {
-		jobChan <- job
+// 记录上传结果，因取消而中断的上传不计为失败
+func (s *MinioService) recordUpload(ctx context.Context, minioPath, objectName, sha1 string, err error) {
+	switch {
+	case err == nil:
+		s.trackObject(minioPath, objectName, sha1)
+		s.recordFile(minioPath, objectName, fileUploaded, nil)
+	case ctx.Err() == nil:
+		s.recordFile(minioPath, objectName, fileFailed, err)
 	}
-	close(jobChan)
-	wg.Wait()
+}
 
-	// 删除Minio中存在但本地不存在的文件
-	existingObjects, err := s.ListObjects(minioPath)
-	if err != nil {
-		return fmt.Errorf("获取Minio文件列表失败: %v", err)
-	}
-	for _, obj := range existingObjects {
-		pfMutex.Lock()
-		_, exists := processedFiles[obj.Key]
-		pfMutex.Unlock()
-		if !exists {
-			log.Printf("删除已移除的文件: %s", obj.Key)
-			if err := s.removeObject(obj.Key); err != nil {
-				log.Printf("删除文件失败 %s: %v", obj.Key, err)
+// 更新文件计数和进度
+func (s *MinioService) recordFile(minioPath, objectName string, outcome fileOutcome, err error) {
+	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		switch outcome {
+		case fileUploaded:
+			status.Uploaded++
+		case fileSkipped:
+			status.Skipped++
+		case fileDeleted:
+			status.Deleted++
+		case fileFailed:
+			status.Failed++
+			status.FailedFiles = append(status.FailedFiles, FailedFile{Path: objectName, Error: err.Error()})
+			if len(status.FailedFiles) > maxFailedFiles {
+				status.FailedFiles = status.FailedFiles[len(status.FailedFiles)-maxFailedFiles:]
 			}
 		}
+		status.CurrentFiles++
+		if status.TotalFiles > 0 {
+			status.Progress = float64(status.CurrentFiles) * 100 / float64(status.TotalFiles)
+		}
+		s.publishFile(minioPath, objectName, outcome, err, status.Progress)
+	})
+}
+
+// 构建并确保本地仓库目录存在
+func (s *MinioService) localRoot(localPath string) (string, error) {
+	fullPath := filepath.Clean(filepath.Join(s.config.Git.CachePath, localPath))
+
+	// 确保目录存在并设置正确权限
+	if err := os.MkdirAll(fullPath, 0755); err != nil {
+		return "", fmt.Errorf("创建目录失败 %s: %v", fullPath, err)
+	}
+	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+		return "", fmt.Errorf("本地路径不存在: %s", fullPath)
 	}
+	return fullPath, nil
+}
 
-	// 更新进度
+// 更新同步开始状态
+func (s *MinioService) startSync(minioPath string) {
+	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.Status = "syncing"
+		status.Stage = "upload"
+		status.Progress = 0
+		status.TotalFiles = 0
+		status.CurrentFiles = 0
+		status.Uploaded = 0
+		status.Skipped = 0
+		status.Deleted = 0
+		status.Failed = 0
+		status.FailedFiles = nil
+		status.PendingDeletions = 0
+		status.Error = ""
+		status.LastSync = time.Now()
+	})
+	s.beginManifest(minioPath, nil)
+}
+
+// 更新同步完成状态，存在失败文件时返回 PartialSyncError
+func (s *MinioService) finishSync(minioPath string) error {
+	var failed int
 	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
 		status.Status = "idle"
+		status.Stage = ""
 		status.Progress = 100
 		status.LastSync = time.Now()
+		failed = status.Failed
 	})
-
+	if failed > 0 {
+		return &PartialSyncError{Failed: failed}
+	}
 	return nil
 }
 
-func (s *MinioService) GetObject(objectPath string) (*minio.Object, error) {
-	return s.client.GetObject(
-		context.Background(),
-		s.config.Minio.Bucket,
-		objectPath,
-		minio.GetObjectOptions{},
-	)
+// 同步过程中发生 panic 时记录错误状态并作为错误返回
+func (s *MinioService) recoverSync(minioPath string, err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("panic: %v", r)
+		s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+			status.Status = "error"
+			status.Error = (*err).Error()
+		})
+	}
 }
 
-func (s *MinioService) GetPublicURL(objectPath string) string {
-	// 生成预签名URL，有效期1小时
-	presignedURL, err := s.client.PresignedGetObject(
-		context.Background(),
-		s.config.Minio.Bucket,
-		objectPath,
-		time.Hour,
-		nil,
-	)
+// 使用工作池并发处理文件，ctx 取消后停止派发
+func (s *MinioService) runJobs(ctx context.Context, jobs []fileJob, fn func(fileJob)) {
+	// 使用配置的线程数，如果配置值小于1则使用默认值16
+	maxWorkers := s.config.Minio.MaxWorkers
+	if maxWorkers < 1 {
+		maxWorkers = 16
+	}
+
+	jobChan := make(chan fileJob)
+	var wg sync.WaitGroup
+
+	wg.Add(maxWorkers)
+	for i := 0; i < maxWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobChan {
+				if ctx.Err() != nil {
+					continue
+				}
+				fn(job)
+			}
+		}()
+	}
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			break
+		}
+		jobChan <- job
+	}
+	close(jobChan)
+	wg.Wait()
+}
+
+// 上传单个文件，失败时重试，minioPath 用于查找仓库的内容类型覆盖配置
+func (s *MinioService) uploadFile(ctx context.Context, minioPath string, job fileJob, sha1Hash string) error {
+	// 打开文件
+	file, err := os.Open(job.fullLocalPath)
 	if err != nil {
-		if s.config.Logs.PresignLog {
-			log.Printf("PreSign failed: %s: %v", objectPath, err)
+		log.Printf("打开文件失败 %s: %v", job.objectName, err)
+		return err
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLen)
+	n, _ := io.ReadFull(file, head)
+	contentType := detectContentType(job.fullLocalPath, head[:n], s.contentTypeOverrides(minioPath)...)
+
+	// 修改上传文件时设置的元数据键为 "Sha1"
+	userMetadata := map[string]string{
+		"Sha1": sha1Hash,
+	}
+	maxRetries := 3
+	var uploadErr error
+	for i := 0; i < maxRetries; i++ {
+		// 重置文件指针以便重传
+		if _, err := file.Seek(0, 0); err != nil {
+			log.Printf("重置文件指针失败 %s: %v", job.objectName, err)
+			return err
+		}
+		_, uploadErr = s.storage.Put(ctx, "", job.objectName, file, job.size, PutOptions{
+			ContentType: contentType,
+			Metadata:    userMetadata,
+		})
+		if uploadErr == nil {
+			log.Printf("成功上传文件: %s", job.objectName)
+			return nil
+		}
+		log.Printf("第%d次上传失败 %s: %v", i+1, job.objectName, uploadErr)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
 		}
-		return ""
 	}
-	if s.config.Logs.PresignLog {
-		log.Printf("PreSign success: %s -> %s", objectPath, presignedURL.String())
+	return uploadErr
+}
+
+// 同步被取消时记录 cancelled 状态，其他错误原样返回
+func (s *MinioService) finishCancelled(ctx context.Context, minioPath string, err error) error {
+	if ctx.Err() == nil {
+		return err
 	}
-	return presignedURL.String()
+	log.Printf("同步已取消: %s", minioPath)
+	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.Status = "cancelled"
+		status.Error = ""
+	})
+	return ctx.Err()
 }
 
 // 修改权限检查和设置函数
@@ -513,34 +688,3 @@ func ensureFilePermissions(path string) error {
 
 	return nil
 }
-
-// 新增从指定桶获取对象的方法
-func (s *MinioService) GetObjectFromBucket(bucketName, objectPath string) (*minio.Object, error) {
-	for _, bucket := range s.config.Buckets {
-		if bucket.Name == bucketName {
-			client := s.buckets[bucketName]
-			return client.GetObject(
-				context.Background(),
-				bucket.BucketName,
-				path.Join(bucket.BasePath, objectPath),
-				minio.GetObjectOptions{},
-			)
-		}
-	}
-	return nil, fmt.Errorf("bucket not found: %s", bucketName)
-}
-
-// 新增PutObject方法
-func (s *MinioService) PutObject(objectName string, reader io.Reader, size int64, metadata map[string]string) (minio.UploadInfo, error) {
-	return s.client.PutObject(
-		context.Background(),
-		s.config.Minio.Bucket,
-		objectName,
-		reader,
-		size,
-		minio.PutObjectOptions{
-			ContentType:  getContentType(objectName),
-			UserMetadata: metadata,
-		},
-	)
-}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+// 使用内存存储的服务，仓库按 minioPaths 配置，同步状态写入临时目录
+func newMemoryService(t *testing.T, minioPaths ...string) *MinioService {
+	t.Helper()
+	cfg := &config.Config{Storage: config.StorageConfig{Driver: DriverMemory}}
+	cfg.Git.StateFile = filepath.Join(t.TempDir(), "sync-state.json")
+	for _, minioPath := range minioPaths {
+		cfg.Git.Repositories = append(cfg.Git.Repositories, config.Repository{MinioPath: minioPath})
+	}
+	s, err := NewMinioService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func putObject(t *testing.T, s *MinioService, key, body string) {
+	t.Helper()
+	if _, err := s.storage.Put(context.Background(), "", key, bytes.NewReader([]byte(body)), int64(len(body)), PutOptions{}); err != nil {
+		t.Fatalf("写入 %s 失败: %v", key, err)
+	}
+}
+
+func TestUploadChangesRecordsUnreadableFiles(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryService(t, "docs")
+	s.config.Git.CachePath = t.TempDir()
+	repoDir := filepath.Join(s.config.Git.CachePath, "repo")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "index.html"), []byte("index"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// index.html 是文件，index.html/broken 的 Stat 返回 ENOTDIR 而不是不存在
+	changes := []FileChange{
+		{Status: 'M', Path: "index.html"},
+		{Status: 'A', Path: "index.html/broken"},
+	}
+
+	err := s.UploadChanges(ctx, "repo", "docs", changes)
+	var partial *PartialSyncError
+	if !errors.As(err, &partial) || partial.Failed != 1 {
+		t.Fatalf("UploadChanges = %v，期望 1 个文件失败", err)
+	}
+	status := s.GetSyncStatus("docs")
+	if status.Failed != 1 || len(status.FailedFiles) != 1 || status.FailedFiles[0].Path != "docs/index.html/broken" {
+		t.Errorf("同步状态 Failed=%d FailedFiles=%v，期望记录 docs/index.html/broken", status.Failed, status.FailedFiles)
+	}
+	if status.Uploaded != 1 {
+		t.Errorf("Uploaded = %d，期望 1", status.Uploaded)
+	}
+}
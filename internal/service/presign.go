@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"path"
+	"sync"
+	"time"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+// 直接访问地址的生成方式（urlPolicy.mode）
+const (
+	URLModePresign = "presign"
+	URLModePublic  = "public"
+	URLModeProxy   = "proxy"
+)
+
+// 预签名URL默认有效期
+const defaultPresignExpiry = time.Hour
+
+// 缓存的预签名URL数量上限，超过时先清理需要重新生成的条目
+const maxPresignedURLs = 10000
+
+type presignKey struct {
+	bucket string
+	key    string
+	opts   PresignOptions
+}
+
+type cachedPresign struct {
+	url     string
+	refresh time.Time // 超过该时间后重新生成
+}
+
+// 预签名URL缓存：同一对象的地址在有效期的前 3/4 内重复使用，
+// 跳转目标因此保持稳定，浏览器和 CDN 可以缓存，返回的地址剩余有效期始终不少于 1/4
+type presignCache struct {
+	mutex   sync.Mutex
+	entries map[presignKey]cachedPresign
+}
+
+func newPresignCache() *presignCache {
+	return &presignCache{entries: make(map[presignKey]cachedPresign)}
+}
+
+func (c *presignCache) presign(ctx context.Context, storage Storage, bucket, key string, opts PresignOptions) (string, error) {
+	k := presignKey{bucket: bucket, key: key, opts: opts}
+	now := time.Now()
+
+	c.mutex.Lock()
+	entry, ok := c.entries[k]
+	c.mutex.Unlock()
+	if ok && now.Before(entry.refresh) {
+		return entry.url, nil
+	}
+
+	url, err := storage.Presign(ctx, bucket, key, opts)
+	if err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.entries) >= maxPresignedURLs {
+		for k, entry := range c.entries {
+			if !now.Before(entry.refresh) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxPresignedURLs {
+			c.entries = make(map[presignKey]cachedPresign)
+		}
+	}
+	c.entries[k] = cachedPresign{url: url, refresh: now.Add(opts.Expiry - PresignMaxAge(opts.Expiry))}
+	return url, nil
+}
+
+// PresignMaxAge 预签名URL可以被缓存的时长：缓存返回的地址剩余有效期始终不少于该值
+func PresignMaxAge(expiry time.Duration) time.Duration {
+	return expiry / 4
+}
+
+// ObjectURL 按策略生成对象的直接访问地址，maxAge 为地址可以被缓存的时长，0 表示不过期；
+// 策略为 proxy 或存储后端不支持时返回 ErrNotSupported
+func ObjectURL(ctx context.Context, storage Storage, bucket, key string, policy config.URLPolicy) (url string, maxAge time.Duration, err error) {
+	switch policy.Mode {
+	case "", URLModePresign:
+		opts, err := presignOptions(key, policy)
+		if err != nil {
+			return "", 0, err
+		}
+		url, err := storage.Presign(ctx, bucket, key, opts)
+		if err != nil {
+			return "", 0, err
+		}
+		return url, PresignMaxAge(opts.Expiry), nil
+	case URLModePublic:
+		url, err := storage.PublicURL(ctx, bucket, key, policy.BaseURL)
+		return url, 0, err
+	case URLModeProxy:
+		return "", 0, ErrNotSupported
+	default:
+		return "", 0, fmt.Errorf("未知的 urlPolicy.mode: %s", policy.Mode)
+	}
+}
+
+// 由策略生成预签名选项：有效期默认1小时，"attachment"/"inline" 附加文件名，时间间隔转换为 max-age
+func presignOptions(key string, policy config.URLPolicy) (PresignOptions, error) {
+	opts := PresignOptions{Expiry: defaultPresignExpiry}
+	if policy.Expiry != "" {
+		expiry, err := parseDurationCustom(policy.Expiry)
+		if err != nil {
+			return opts, fmt.Errorf("无效的预签名有效期 %s: %v", policy.Expiry, err)
+		}
+		opts.Expiry = expiry
+	}
+
+	switch policy.ContentDisposition {
+	case "attachment", "inline":
+		opts.ContentDisposition = mime.FormatMediaType(policy.ContentDisposition, map[string]string{"filename": path.Base(key)})
+	default:
+		opts.ContentDisposition = policy.ContentDisposition
+	}
+
+	opts.CacheControl = policy.CacheControl
+	if policy.CacheControl != "" {
+		if duration, err := parseDurationCustom(policy.CacheControl); err == nil {
+			opts.CacheControl = fmt.Sprintf("public, max-age=%d", int(duration.Seconds()))
+		}
+	}
+	return opts, nil
+}
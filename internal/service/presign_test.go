@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+// 记录 Presign 调用次数的存储，每次生成不同的地址
+type countingPresignStorage struct {
+	Storage
+	calls int
+	err   error
+}
+
+func (c *countingPresignStorage) Presign(ctx context.Context, bucket, key string, opts PresignOptions) (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	c.calls++
+	return fmt.Sprintf("https://s3.example.com/%s/%s?sig=%d", bucket, key, c.calls), nil
+}
+
+func TestPresignCacheReusesURLUntilRefresh(t *testing.T) {
+	ctx := context.Background()
+	storage := &countingPresignStorage{Storage: NewMemoryStorage()}
+	cache := newPresignCache()
+	opts := PresignOptions{Expiry: time.Hour}
+
+	first, err := cache.presign(ctx, storage, "", "docs/a.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := cache.presign(ctx, storage, "", "docs/a.txt", opts); again != first || storage.calls != 1 {
+		t.Errorf("有效期前 3/4 内应重复使用地址，得到 %q，调用 %d 次", again, storage.calls)
+	}
+
+	// 对象或选项不同时分别生成
+	cache.presign(ctx, storage, "", "docs/b.txt", opts)
+	cache.presign(ctx, storage, "", "docs/a.txt", PresignOptions{Expiry: time.Hour, ContentDisposition: "attachment"})
+	if storage.calls != 3 {
+		t.Errorf("Presign 调用 %d 次，期望 3 次", storage.calls)
+	}
+
+	// 超过刷新时间后重新生成
+	k := presignKey{key: "docs/a.txt", opts: opts}
+	entry := cache.entries[k]
+	if remaining := entry.refresh.Sub(time.Now()); remaining <= 44*time.Minute || remaining > 45*time.Minute {
+		t.Errorf("刷新时间在 %v 之后，期望约 45 分钟", remaining)
+	}
+	entry.refresh = time.Now().Add(-time.Second)
+	cache.entries[k] = entry
+	refreshed, err := cache.presign(ctx, storage, "", "docs/a.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed == first || storage.calls != 4 {
+		t.Errorf("过期后应重新生成，得到 %q，调用 %d 次", refreshed, storage.calls)
+	}
+
+	// 生成失败时不缓存
+	storage.err = errors.New("签名失败")
+	if _, err := cache.presign(ctx, storage, "", "docs/c.txt", opts); err == nil {
+		t.Fatal("期望返回签名错误")
+	}
+	if _, ok := cache.entries[presignKey{key: "docs/c.txt", opts: opts}]; ok {
+		t.Error("失败的结果不应缓存")
+	}
+}
+
+func TestObjectURL(t *testing.T) {
+	ctx := context.Background()
+	storage := &countingPresignStorage{Storage: NewMemoryStorage()}
+
+	cases := []struct {
+		name   string
+		key    string
+		policy config.URLPolicy
+		url    string
+		maxAge time.Duration
+		err    error
+	}{
+		{"默认预签名", "docs/a.txt", config.URLPolicy{}, "https://s3.example.com//docs/a.txt?sig=1", 15 * time.Minute, nil},
+		{"预签名有效期", "docs/a.txt", config.URLPolicy{Mode: URLModePresign, Expiry: "2h"}, "https://s3.example.com//docs/a.txt?sig=2", 30 * time.Minute, nil},
+		{"CDN 地址", "docs/中文 a.txt", config.URLPolicy{Mode: URLModePublic, BaseURL: "https://cdn.example.com/files/"}, "https://cdn.example.com/files/docs/%E4%B8%AD%E6%96%87%20a.txt", 0, nil},
+		{"本地存储没有公开地址", "docs/a.txt", config.URLPolicy{Mode: URLModePublic}, "", 0, ErrNotSupported},
+		{"代理", "docs/a.txt", config.URLPolicy{Mode: URLModeProxy}, "", 0, ErrNotSupported},
+	}
+	for _, c := range cases {
+		url, maxAge, err := ObjectURL(ctx, storage, "", c.key, c.policy)
+		if !errors.Is(err, c.err) || url != c.url || maxAge != c.maxAge {
+			t.Errorf("%s: ObjectURL = %q, %v, %v，期望 %q, %v, %v", c.name, url, maxAge, err, c.url, c.maxAge, c.err)
+		}
+	}
+	for _, policy := range []config.URLPolicy{{Mode: "cdn"}, {Expiry: "soon"}} {
+		if _, _, err := ObjectURL(ctx, storage, "", "docs/a.txt", policy); err == nil {
+			t.Errorf("策略 %+v 应返回错误", policy)
+		}
+	}
+}
+
+func TestPresignOptions(t *testing.T) {
+	opts, err := presignOptions("docs/report.pdf", config.URLPolicy{ContentDisposition: "attachment", CacheControl: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PresignOptions{Expiry: time.Hour, ContentDisposition: "attachment; filename=report.pdf", CacheControl: "public, max-age=3600"}
+	if opts != want {
+		t.Errorf("presignOptions = %+v，期望 %+v", opts, want)
+	}
+	opts, _ = presignOptions("docs/a.txt", config.URLPolicy{ContentDisposition: `inline; filename="x"`, CacheControl: "no-store"})
+	if opts.ContentDisposition != `inline; filename="x"` || opts.CacheControl != "no-store" {
+		t.Errorf("其他值应原样使用，得到 %+v", opts)
+	}
+}
+
+func TestPublishedURLsPointToActiveRelease(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryService(t, "docs")
+	putObject(t, s, ReleasesPrefix+"docs/r1/index.html", "release")
+	putObject(t, s, releasePointerKey("docs"), `{"release":"r1"}`)
+	counting := &countingPresignStorage{Storage: s.storage}
+	s.storage = counting
+	storage := s.Storage()
+
+	url, err := storage.PublicURL(ctx, "", "docs/index.html", "https://cdn.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://cdn.example.com/" + ReleasesPrefix + "docs/r1/index.html"; url != want {
+		t.Errorf("公开地址 = %q，期望 %q", url, want)
+	}
+
+	// 预签名地址按实际的对象键缓存
+	opts := PresignOptions{Expiry: time.Hour}
+	first, err := storage.Presign(ctx, "", "docs/index.html", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := storage.Presign(ctx, "", "docs/index.html", opts); again != first || counting.calls != 1 {
+		t.Errorf("应重复使用缓存的预签名地址，得到 %q，调用 %d 次", again, counting.calls)
+	}
+	if _, err := storage.PublicURL(ctx, "", ReleasesPrefix+"docs/r1/index.html", "https://cdn.example.com"); err == nil {
+		t.Error("不应生成 release 目录的地址")
+	}
+}
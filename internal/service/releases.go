@@ -0,0 +1,670 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReleasesPrefix 原子发布时各仓库 release 目录在默认存储中的前缀：
+// .releases/{minioPath}/{id}/ 为一次发布的完整内容，
+// .releases/{minioPath}/active.json 指向当前发布的 release
+const ReleasesPrefix = ".releases/"
+
+// 发布指针
+type releasePointer struct {
+	Release string    `json:"release"`
+	Time    time.Time `json:"time"`
+}
+
+func releaseDir(minioPath string) string {
+	return ReleasesPrefix + minioPath + "/"
+}
+
+func releasePrefix(minioPath, id string) string {
+	return releaseDir(minioPath) + id
+}
+
+func releasePointerKey(minioPath string) string {
+	return releaseDir(minioPath) + "active.json"
+}
+
+func newReleaseID() string {
+	return time.Now().UTC().Format("20060102T150405.000Z")
+}
+
+// 仓库当前发布的 release，未使用原子发布时返回空字符串。
+// 读取发布指针失败时返回错误且不缓存，避免在存储暂时不可用时回退到 minioPath 下的旧内容
+func (s *MinioService) activeRelease(minioPath string) (string, error) {
+	s.releaseMutex.RLock()
+	id, ok := s.releases[minioPath]
+	s.releaseMutex.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	obj, err := s.storage.Get(context.Background(), "", releasePointerKey(minioPath))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("读取发布指针失败 %s: %v", minioPath, err)
+			return "", fmt.Errorf("读取发布指针失败: %v", err)
+		}
+	} else {
+		var pointer releasePointer
+		err = json.NewDecoder(obj).Decode(&pointer)
+		obj.Close()
+		if err != nil {
+			log.Printf("解析发布指针失败 %s: %v", minioPath, err)
+			return "", fmt.Errorf("解析发布指针失败: %v", err)
+		}
+		id = pointer.Release
+	}
+
+	s.releaseMutex.Lock()
+	s.releases[minioPath] = id
+	s.releaseMutex.Unlock()
+	return id, nil
+}
+
+// 仓库是否使用原子发布，关闭配置后在下一次完整同步前仍按原子发布处理
+func (s *MinioService) atomicPublish(minioPath string) (bool, error) {
+	if repo := s.repository(minioPath); repo != nil && repo.AtomicPublish {
+		return true, nil
+	}
+	id, err := s.activeRelease(minioPath)
+	return id != "", err
+}
+
+// 仓库当前发布内容所在的前缀
+func (s *MinioService) livePrefix(minioPath string) (string, error) {
+	id, err := s.activeRelease(minioPath)
+	if err != nil {
+		return "", err
+	}
+	if id != "" {
+		return releasePrefix(minioPath, id), nil
+	}
+	return minioPath, nil
+}
+
+// 切换发布指针，id 为空时删除指针，恢复为直接使用 minioPath
+func (s *MinioService) setActiveRelease(ctx context.Context, minioPath, id string) error {
+	if id == "" {
+		if err := s.storage.Remove(ctx, "", releasePointerKey(minioPath)); err != nil {
+			return err
+		}
+	} else {
+		data, err := json.Marshal(releasePointer{Release: id, Time: time.Now()})
+		if err != nil {
+			return err
+		}
+		if _, err := s.storage.Put(ctx, "", releasePointerKey(minioPath), bytes.NewReader(data), int64(len(data)), PutOptions{ContentType: "application/json"}); err != nil {
+			return err
+		}
+	}
+
+	s.releaseMutex.Lock()
+	s.releases[minioPath] = id
+	s.releaseMutex.Unlock()
+	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.Release = id
+	})
+	return nil
+}
+
+// 查找对象键所属的仓库（最长匹配），返回仓库路径和相对路径
+func (s *MinioService) splitRepoKey(key string) (minioPath, rel string, ok bool) {
+	for _, repo := range s.config.Git.Repositories {
+		if strings.HasPrefix(key, repo.MinioPath+"/") && len(repo.MinioPath) > len(minioPath) {
+			minioPath = repo.MinioPath
+		}
+	}
+	if minioPath == "" {
+		return "", "", false
+	}
+	return minioPath, strings.TrimPrefix(key, minioPath+"/"), true
+}
+
+// PublishRelease 将本地目录上传到新的 release 目录，全部成功后切换发布指针，
+// 读者在切换前后分别看到完整的旧版本和新版本。changes 不为 nil 时，
+// 未变更的文件直接从当前版本复制，否则逐个比较 SHA1 决定复制还是上传
+func (s *MinioService) PublishRelease(ctx context.Context, localPath, minioPath string, changes []FileChange) (err error) {
+	s.startSync(minioPath)
+	defer s.recoverSync(minioPath, &err)
+
+	fullPath, filter, err := s.publishRoot(localPath, minioPath)
+	if err != nil {
+		return err
+	}
+	live, err := s.livePrefix(minioPath)
+	if err != nil {
+		return err
+	}
+	previous, _ := s.activeRelease(minioPath) // livePrefix 已读取并缓存发布指针
+	id := newReleaseID()
+	staging := releasePrefix(minioPath, id)
+	log.Printf("开始发布 %s 到 %s", minioPath, staging)
+
+	var changed map[string]bool
+	if changes != nil {
+		changed = make(map[string]bool, len(changes))
+		for _, change := range changes {
+			if rel, ok := filter.relative(change.Path); ok {
+				changed[rel] = true
+			}
+		}
+	}
+
+	jobs, err := s.localFiles(ctx, fullPath, minioPath, filter)
+	if err != nil {
+		return s.finishCancelled(ctx, minioPath, err)
+	}
+
+	// 新版本中不再包含的文件，切换前检查删除数量
+	existing, err := s.repoObjects(ctx, minioPath, live)
+	if err != nil {
+		return err
+	}
+	local := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		local[job.objectName] = true
+	}
+	var planned int
+	for _, rel := range existing {
+		if !local[minioPath+"/"+rel] {
+			planned++
+		}
+	}
+	if err := s.checkDeletions(ctx, minioPath, planned, len(existing), len(jobs)); err != nil {
+		return err
+	}
+	s.beginManifest(minioPath, map[string]string{})
+	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.TotalFiles = len(jobs)
+	})
+
+	s.runJobs(ctx, jobs, func(job fileJob) {
+		if s.config.Logs.ProcessLog {
+			log.Printf("Processing: %s -> %s", job.fullLocalPath, job.objectName)
+		}
+		rel := strings.TrimPrefix(job.objectName, minioPath+"/")
+		sha1Hash, err := calculateSHA1(job.fullLocalPath)
+		if err != nil {
+			log.Printf("计算文件 %s SHA1失败: %v", job.objectName, err)
+			s.recordFile(minioPath, job.objectName, fileFailed, err)
+			return
+		}
+
+		unchanged := changed != nil && !changed[rel]
+		if changed == nil {
+			info, err := s.storage.Stat(ctx, "", live+"/"+rel)
+			unchanged = err == nil && info.Metadata["Sha1"] == sha1Hash
+		}
+		// 未变更的文件从当前版本复制，当前版本缺少该文件时改为上传
+		if unchanged && s.storage.Copy(ctx, "", live+"/"+rel, staging+"/"+rel) == nil {
+			s.trackObject(minioPath, job.objectName, sha1Hash)
+			s.recordFile(minioPath, job.objectName, fileSkipped, nil)
+			return
+		}
+		upload := fileJob{fullLocalPath: job.fullLocalPath, objectName: staging + "/" + rel, size: job.size}
+		s.recordUpload(ctx, minioPath, job.objectName, sha1Hash, s.uploadFile(ctx, minioPath, upload, sha1Hash))
+	})
+
+	if err := ctx.Err(); err != nil {
+		s.discardRelease(minioPath, staging)
+		return s.finishCancelled(ctx, minioPath, err)
+	}
+	return s.commitRelease(ctx, minioPath, id, previous, s.manifestSnapshot(minioPath), true)
+}
+
+// 收集本地目录中待同步的文件，跳过 .git 目录
+func (s *MinioService) localFiles(ctx context.Context, fullPath, minioPath string, filter *publishFilter) ([]fileJob, error) {
+	var jobs []fileJob
+	err := filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			// 处理权限错误
+			if os.IsPermission(err) {
+				log.Printf("权限不足 %s: %v", path, err)
+				return nil // 跳过此文件但继续处理
+			}
+			return err
+		}
+		// 跳过目录和.git文件夹，子模块中的 .git 为文件
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() == ".git" {
+			return nil
+		}
+		relPath, err := filepath.Rel(fullPath, path)
+		if err != nil {
+			return err
+		}
+		if !filter.allowed(filepath.ToSlash(relPath)) {
+			return nil
+		}
+		// 规范化对象名称
+		objName := filepath.Join(minioPath, relPath)
+		// 统一使用 / 作为路径分隔符
+		objName = strings.ReplaceAll(objName, string(os.PathSeparator), "/")
+		jobs = append(jobs, fileJob{fullLocalPath: path, objectName: objName, size: info.Size()})
+		return nil
+	})
+	return jobs, err
+}
+
+// 检查 release 的内容后切换发布指针，并清理不再需要的旧目录。
+// files 为新版本的文件清单（相对路径 -> SHA1），staged 表示 release 为本次新建，失败时需要删除
+func (s *MinioService) commitRelease(ctx context.Context, minioPath, id, previous string, files map[string]string, staged bool) error {
+	abort := func() {
+		if staged {
+			s.discardRelease(minioPath, releasePrefix(minioPath, id))
+		}
+	}
+	status := s.GetSyncStatus(minioPath)
+	if status.Failed > 0 {
+		abort()
+		return fmt.Errorf("%d 个文件同步失败，未切换发布版本", status.Failed)
+	}
+
+	// 当前版本中有而新版本中没有的文件
+	live, err := s.livePrefix(minioPath)
+	if err != nil {
+		abort()
+		return err
+	}
+	existing, err := s.repoObjects(ctx, minioPath, live)
+	if err != nil {
+		abort()
+		return err
+	}
+	var removed []string
+	for _, rel := range existing {
+		if _, ok := files[rel]; !ok {
+			removed = append(removed, rel)
+		}
+	}
+
+	if staged && previous != "" && status.Uploaded == 0 && len(removed) == 0 {
+		log.Printf("发布内容没有变化，保留当前版本: %s", minioPath)
+		abort()
+		return s.finishSync(minioPath)
+	}
+
+	if err := s.setActiveRelease(ctx, minioPath, id); err != nil {
+		abort()
+		return fmt.Errorf("切换发布版本失败: %v", err)
+	}
+	log.Printf("已切换发布版本 %s: %s", minioPath, id)
+
+	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.TotalFiles += len(removed)
+	})
+	for _, rel := range removed {
+		s.recordFile(minioPath, minioPath+"/"+rel, fileDeleted, nil)
+	}
+
+	// 保留上一个版本，切换前开始的读取仍可完成
+	liveSHA1 := make(map[string]bool, len(files))
+	for _, sha1 := range files {
+		liveSHA1[sha1] = true
+	}
+	s.gcReleases(ctx, minioPath, map[string]bool{id: true, previous: true}, liveSHA1)
+	return s.finishSync(minioPath)
+}
+
+// 删除未能发布的 release 目录，同步被取消时也需要执行，因此不使用同步的 ctx
+func (s *MinioService) discardRelease(minioPath, prefix string) {
+	ctx := context.Background()
+	objects, err := s.storage.List(ctx, "", prefix+"/")
+	if err != nil {
+		log.Printf("清理未发布的目录失败 %s: %v", prefix, err)
+		return
+	}
+	for _, obj := range objects {
+		if err := s.storage.Remove(ctx, "", obj.Key); err != nil {
+			log.Printf("删除文件失败 %s: %v", obj.Key, err)
+		}
+	}
+	log.Printf("已清理未发布的目录 %s: %s", minioPath, prefix)
+}
+
+// 删除 keep 以外的 release 目录，keep 不包含空字符串时同时删除直接位于 minioPath 下的文件；
+// 删除前保存 SHA1 不在 live 中的文件内容，以便回滚
+func (s *MinioService) gcReleases(ctx context.Context, minioPath string, keep, live map[string]bool) {
+	var stale []string
+	if !keep[""] {
+		objects, err := s.storage.List(ctx, "", minioPath+"/")
+		if err != nil {
+			log.Printf("获取文件列表失败 %s: %v", minioPath, err)
+			return
+		}
+		for _, obj := range objects {
+			if mp, _, _ := s.splitRepoKey(obj.Key); mp == minioPath {
+				stale = append(stale, obj.Key)
+			}
+		}
+	}
+	objects, err := s.storage.List(ctx, "", releaseDir(minioPath))
+	if err != nil {
+		log.Printf("获取发布目录失败 %s: %v", minioPath, err)
+		return
+	}
+	for _, obj := range objects {
+		id, _, isDir := strings.Cut(strings.TrimPrefix(obj.Key, releaseDir(minioPath)), "/")
+		if isDir && !keep[id] {
+			stale = append(stale, obj.Key)
+		}
+	}
+
+	versioned := s.keepVersions(minioPath) > 0
+	for _, key := range stale {
+		if ctx.Err() != nil {
+			return
+		}
+		if versioned {
+			if info, err := s.storage.Stat(ctx, "", key); err == nil && !live[info.Metadata["Sha1"]] {
+				s.archiveObject(ctx, minioPath, key)
+			}
+		}
+		if err := s.storage.Remove(ctx, "", key); err != nil {
+			log.Printf("删除旧版本文件失败 %s: %v", key, err)
+		}
+	}
+	if len(stale) > 0 {
+		log.Printf("已清理旧版本文件 %s: %d 个", minioPath, len(stale))
+	}
+}
+
+// 关闭原子发布后，内容已完整上传到 minioPath，删除发布指针和所有 release 目录
+func (s *MinioService) retireReleases(ctx context.Context, minioPath string) error {
+	if err := s.setActiveRelease(ctx, minioPath, ""); err != nil {
+		return fmt.Errorf("删除发布指针失败: %v", err)
+	}
+	log.Printf("已停用原子发布: %s", minioPath)
+	s.gcReleases(ctx, minioPath, map[string]bool{"": true}, nil)
+	return nil
+}
+
+// 原子发布模式下回滚：版本对应的 release 仍完整保留时直接切换指针，
+// 否则从当前版本和保存的旧文件重新组装一个 release
+func (s *MinioService) rollbackRelease(ctx context.Context, minioPath string, v *Version) error {
+	previous, err := s.activeRelease(minioPath)
+	if err != nil {
+		return err
+	}
+	if v.Release != "" && v.Release == previous {
+		log.Printf("版本 %s 已是当前发布的版本: %s", v.ID, minioPath)
+		return s.finishSync(minioPath)
+	}
+	if v.Release != "" {
+		objects, err := s.storage.List(ctx, "", releasePrefix(minioPath, v.Release)+"/")
+		if err == nil && len(objects) == len(v.Objects) {
+			log.Printf("切换到版本 %s 的发布目录: %s", v.ID, minioPath)
+			s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+				status.Skipped = len(objects)
+			})
+			return s.commitRelease(ctx, minioPath, v.Release, previous, v.Objects, false)
+		}
+	}
+
+	live, err := s.livePrefix(minioPath)
+	if err != nil {
+		return err
+	}
+	if err := s.checkVersionBlobs(ctx, minioPath, live, v); err != nil {
+		return err
+	}
+	id := newReleaseID()
+	staging := releasePrefix(minioPath, id)
+	log.Printf("重新组装版本 %s 到 %s", v.ID, staging)
+
+	var jobs []fileJob
+	for rel := range v.Objects {
+		jobs = append(jobs, fileJob{objectName: minioPath + "/" + rel})
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].objectName < jobs[j].objectName })
+	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.TotalFiles = len(jobs)
+	})
+
+	s.runJobs(ctx, jobs, func(job fileJob) {
+		rel := strings.TrimPrefix(job.objectName, minioPath+"/")
+		sha1 := v.Objects[rel]
+		if info, err := s.storage.Stat(ctx, "", live+"/"+rel); err == nil && info.Metadata["Sha1"] == sha1 {
+			if err := s.storage.Copy(ctx, "", live+"/"+rel, staging+"/"+rel); err == nil {
+				s.recordFile(minioPath, job.objectName, fileSkipped, nil)
+				return
+			}
+		}
+		err := s.storage.Copy(ctx, "", blobKey(minioPath, sha1), staging+"/"+rel)
+		if errors.Is(err, os.ErrNotExist) {
+			err = fmt.Errorf("版本中的文件内容已被清理")
+		}
+		if err != nil {
+			log.Printf("恢复文件失败 %s: %v", job.objectName, err)
+		}
+		s.recordUpload(ctx, minioPath, job.objectName, sha1, err)
+	})
+
+	if err := ctx.Err(); err != nil {
+		s.discardRelease(minioPath, staging)
+		return s.finishCancelled(ctx, minioPath, err)
+	}
+	return s.commitRelease(ctx, minioPath, id, previous, v.Objects, true)
+}
+
+// 按当前发布的 release 解析仓库路径的存储，文件服务通过它读取，
+// 始终看到某一次完整发布的内容
+type publishedStorage struct {
+	Storage
+	s *MinioService
+}
+
+type publishedObject struct {
+	Object
+	info ObjectInfo
+}
+
+func (o *publishedObject) Info() ObjectInfo {
+	return o.info
+}
+
+// 默认存储中的 release 目录和版本记录不对外提供，列表中跳过，读取时视为不存在
+func hiddenKey(bucket, key string) bool {
+	return bucket == "" && (strings.HasPrefix(key, ReleasesPrefix) || strings.HasPrefix(key, VersionsPrefix))
+}
+
+func hiddenKeyError(op, key string) error {
+	return &fs.PathError{Op: op, Path: key, Err: fs.ErrNotExist}
+}
+
+// 将默认存储中的仓库路径转换为实际的对象键，无法读取发布指针时返回错误
+func (p *publishedStorage) resolve(bucket, key string) (string, error) {
+	if bucket != "" {
+		return key, nil
+	}
+	if minioPath, rel, ok := p.s.splitRepoKey(key); ok {
+		id, err := p.s.activeRelease(minioPath)
+		if err != nil {
+			return "", err
+		}
+		if id != "" {
+			return releasePrefix(minioPath, id) + "/" + rel, nil
+		}
+	}
+	return key, nil
+}
+
+func (p *publishedStorage) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	if bucket != "" {
+		return p.Storage.List(ctx, bucket, prefix)
+	}
+	// 前缀位于某个仓库内时只需列出该仓库当前的 release
+	if minioPath, rel, ok := p.s.splitRepoKey(prefix); ok {
+		id, err := p.s.activeRelease(minioPath)
+		if err != nil {
+			return nil, err
+		}
+		if id != "" {
+			return p.listRelease(ctx, minioPath, id, rel)
+		}
+	}
+
+	objects, err := p.Storage.List(ctx, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	released := make(map[string]string)
+	for _, repo := range p.s.config.Git.Repositories {
+		if strings.HasPrefix(repo.MinioPath+"/", prefix) {
+			id, err := p.s.activeRelease(repo.MinioPath)
+			if err != nil {
+				return nil, err
+			}
+			if id != "" {
+				released[repo.MinioPath] = id
+			}
+		}
+	}
+
+	// 跳过 release 目录、版本记录以及已切换到 release 的仓库中残留的旧文件
+	var result []ObjectInfo
+	for _, obj := range objects {
+		if hiddenKey(bucket, obj.Key) {
+			continue
+		}
+		if minioPath, _, ok := p.s.splitRepoKey(obj.Key); ok && released[minioPath] != "" {
+			continue
+		}
+		result = append(result, obj)
+	}
+	for minioPath, id := range released {
+		objects, err := p.listRelease(ctx, minioPath, id, "")
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, objects...)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result, nil
+}
+
+func (p *publishedStorage) listRelease(ctx context.Context, minioPath, id, rel string) ([]ObjectInfo, error) {
+	base := releasePrefix(minioPath, id) + "/"
+	objects, err := p.Storage.List(ctx, "", base+rel)
+	if err != nil {
+		return nil, err
+	}
+	for i := range objects {
+		objects[i].Key = minioPath + "/" + strings.TrimPrefix(objects[i].Key, base)
+	}
+	return objects, nil
+}
+
+func (p *publishedStorage) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	if hiddenKey(bucket, key) {
+		return ObjectInfo{}, hiddenKeyError("stat", key)
+	}
+	resolved, err := p.resolve(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := p.Storage.Stat(ctx, bucket, resolved)
+	info.Key = key
+	return info, err
+}
+
+func (p *publishedStorage) Get(ctx context.Context, bucket, key string) (Object, error) {
+	if hiddenKey(bucket, key) {
+		return nil, hiddenKeyError("get", key)
+	}
+	resolved, err := p.resolve(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := p.Storage.Get(ctx, bucket, resolved)
+	if err != nil {
+		return nil, err
+	}
+	info := obj.Info()
+	info.Key = key
+	return &publishedObject{Object: obj, info: info}, nil
+}
+
+func (p *publishedStorage) Put(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) (ObjectInfo, error) {
+	resolved, err := p.resolve(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := p.Storage.Put(ctx, bucket, resolved, reader, size, opts)
+	info.Key = key
+	return info, err
+}
+
+func (p *publishedStorage) Copy(ctx context.Context, bucket, srcKey, dstKey string) error {
+	src, err := p.resolve(bucket, srcKey)
+	if err != nil {
+		return err
+	}
+	dst, err := p.resolve(bucket, dstKey)
+	if err != nil {
+		return err
+	}
+	return p.Storage.Copy(ctx, bucket, src, dst)
+}
+
+func (p *publishedStorage) SetContentType(ctx context.Context, bucket, key, contentType string) error {
+	resolved, err := p.resolve(bucket, key)
+	if err != nil {
+		return err
+	}
+	return p.Storage.SetContentType(ctx, bucket, resolved, contentType)
+}
+
+func (p *publishedStorage) Remove(ctx context.Context, bucket, key string) error {
+	resolved, err := p.resolve(bucket, key)
+	if err != nil {
+		return err
+	}
+	return p.Storage.Remove(ctx, bucket, resolved)
+}
+
+// 预签名URL按实际的对象键缓存，切换 release 后生成新的地址
+func (p *publishedStorage) Presign(ctx context.Context, bucket, key string, opts PresignOptions) (string, error) {
+	if hiddenKey(bucket, key) {
+		return "", hiddenKeyError("presign", key)
+	}
+	resolved, err := p.resolve(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	return p.s.presigned.presign(ctx, p.Storage, bucket, resolved, opts)
+}
+
+func (p *publishedStorage) PublicURL(ctx context.Context, bucket, key, baseURL string) (string, error) {
+	if hiddenKey(bucket, key) {
+		return "", hiddenKeyError("presign", key)
+	}
+	resolved, err := p.resolve(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	return p.Storage.PublicURL(ctx, bucket, resolved, baseURL)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublishedStorageHidesVersionsAndReleases(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryService(t, "docs")
+	putObject(t, s, "docs/index.html", "index")
+	putObject(t, s, VersionsPrefix+"docs/blobs/0123abcd", "deleted secret")
+	putObject(t, s, VersionsPrefix+"docs/manifests/v1.json", "{}")
+	putObject(t, s, ReleasesPrefix+"docs/r1/index.html", "release")
+	storage := s.Storage()
+
+	for _, prefix := range []string{"", VersionsPrefix, VersionsPrefix + "docs/", ReleasesPrefix} {
+		objects, err := storage.List(ctx, "", prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, obj := range objects {
+			if strings.HasPrefix(obj.Key, VersionsPrefix) || strings.HasPrefix(obj.Key, ReleasesPrefix) {
+				t.Errorf("List(%q) 不应返回 %s", prefix, obj.Key)
+			}
+		}
+	}
+
+	for _, key := range []string{VersionsPrefix + "docs/blobs/0123abcd", ReleasesPrefix + "docs/r1/index.html"} {
+		if _, err := storage.Stat(ctx, "", key); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Stat(%s) = %v，期望不存在", key, err)
+		}
+		if _, err := storage.Get(ctx, "", key); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Get(%s) = %v，期望不存在", key, err)
+		}
+		if _, err := storage.Presign(ctx, "", key, PresignOptions{Expiry: time.Hour}); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Presign(%s) = %v，期望不存在", key, err)
+		}
+	}
+
+	if _, err := storage.Stat(ctx, "", "docs/index.html"); err != nil {
+		t.Errorf("仓库中的文件应可以访问: %v", err)
+	}
+}
+
+// 读取指定对象时返回错误的存储，模拟存储暂时不可用
+type failingGetStorage struct {
+	Storage
+	key string
+	err error
+}
+
+func (f *failingGetStorage) Get(ctx context.Context, bucket, key string) (Object, error) {
+	if key == f.key && f.err != nil {
+		return nil, f.err
+	}
+	return f.Storage.Get(ctx, bucket, key)
+}
+
+func TestPublishedStorageFailsWhenReleasePointerIsUnreadable(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryService(t, "docs")
+	putObject(t, s, "docs/index.html", "legacy")
+	putObject(t, s, ReleasesPrefix+"docs/r1/index.html", "release")
+	putObject(t, s, releasePointerKey("docs"), `{"release":"r1"}`)
+	failing := &failingGetStorage{Storage: s.storage, key: releasePointerKey("docs"), err: errors.New("连接被拒绝")}
+	s.storage = failing
+	storage := s.Storage()
+
+	// 读取发布指针失败时返回错误，而不是回退到 minioPath 下的旧内容
+	if _, err := storage.Get(ctx, "", "docs/index.html"); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Get = %v，期望读取发布指针的错误", err)
+	}
+	if _, err := storage.List(ctx, "", "docs/"); err == nil {
+		t.Fatal("List 应返回读取发布指针的错误")
+	}
+
+	// 存储恢复后读取当前 release
+	failing.err = nil
+	obj, err := storage.Get(ctx, "", "docs/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	if data, _ := io.ReadAll(obj); string(data) != "release" {
+		t.Errorf("docs/index.html = %q，期望 release 中的内容", data)
+	}
+}
@@ -0,0 +1,438 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"pysio.online/Files-API/internal/config"
+)
+
+// 同步来源类型
+const (
+	SourceGit     = "git"
+	SourceArchive = "archive"
+	SourceS3      = "s3"
+)
+
+// source 非 git 的同步来源，把内容同步到本地目录后与 git 仓库一样按 SHA1 比较上传
+type source interface {
+	// fetch 将内容同步到 dir，state 为上次同步保存的状态，调用方在成功后保存；
+	// state.Commit 为内容的摘要，作为发布的提交
+	fetch(ctx context.Context, dir string, state *sourceState) error
+}
+
+// 来源的同步状态，保存在本地目录旁的 .source.json 文件中
+type sourceState struct {
+	Commit       string            `json:"commit"`
+	ETag         string            `json:"etag,omitempty"`         // archive: 上次下载的 ETag
+	LastModified string            `json:"lastModified,omitempty"` // archive: 上次下载的 Last-Modified
+	Objects      map[string]string `json:"objects,omitempty"`      // s3: 对象键 -> ETag
+}
+
+// 仓库是否使用非 git 来源
+func isSourceRepo(repo *config.Repository) bool {
+	return repo.Source != "" && repo.Source != SourceGit
+}
+
+func (m *SyncManager) newSource(repo *config.Repository) (source, error) {
+	switch repo.Source {
+	case SourceArchive:
+		return &archiveSource{repo: repo}, nil
+	case SourceS3:
+		return newS3Source(m.config, repo)
+	}
+	return nil, fmt.Errorf("不支持的同步来源: %s", repo.Source)
+}
+
+// 同步非 git 来源到本地缓存目录
+func (m *SyncManager) fetchSource(ctx context.Context, repo *config.Repository) (*SyncResult, error) {
+	src, err := m.newSource(repo)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Clean(filepath.Join(m.config.Git.CachePath, repo.LocalPath))
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return nil, fmt.Errorf("创建缓存目录失败: %v", err)
+	}
+
+	statePath := dir + ".source.json"
+	var state sourceState
+	if data, err := os.ReadFile(statePath); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	// 本地目录丢失时重新下载全部内容
+	if _, err := os.Stat(dir); err != nil {
+		state = sourceState{}
+	}
+	result := &SyncResult{PreviousCommit: state.Commit}
+
+	log.Printf("同步 %s 来源: %s", repo.Source, redactURL(repo.URL))
+	if err := src.fetch(ctx, dir, &state); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(statePath, data, 0644); err != nil {
+		return nil, fmt.Errorf("保存来源状态失败: %v", err)
+	}
+	result.Commit = state.Commit
+	return result, nil
+}
+
+// archiveSource 从 URL 下载 tar、tar.gz、tar.bz2 或 zip 包并解压
+type archiveSource struct {
+	repo *config.Repository
+}
+
+func (a *archiveSource) fetch(ctx context.Context, dir string, state *sourceState) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.repo.URL, nil)
+	if err != nil {
+		return fmt.Errorf("无效的下载地址: %v", redactURL(err.Error()))
+	}
+	if state.Commit != "" {
+		if state.ETag != "" {
+			req.Header.Set("If-None-Match", state.ETag)
+		}
+		if state.LastModified != "" {
+			req.Header.Set("If-Modified-Since", state.LastModified)
+		}
+	}
+	if err := setSourceAuth(req, a.repo.Auth); err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("下载失败: %v", redactURL(err.Error()))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		log.Printf("压缩包未变化: %s", redactURL(a.repo.URL))
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("下载失败: HTTP %d", resp.StatusCode)
+	}
+
+	// 下载到临时文件，同时计算摘要
+	tmp, err := os.CreateTemp(filepath.Dir(dir), filepath.Base(dir)+".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha1.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("下载失败: %v", err)
+	}
+
+	commit := hex.EncodeToString(hash.Sum(nil))
+	if commit != state.Commit {
+		if err := replaceDir(dir, func(extractDir string) error {
+			return extractArchive(tmp.Name(), extractDir, a.repo.StripComponents)
+		}); err != nil {
+			return err
+		}
+	}
+	state.Commit = commit
+	state.ETag = resp.Header.Get("ETag")
+	state.LastModified = resp.Header.Get("Last-Modified")
+	return nil
+}
+
+// 下载请求的认证：token 使用 Bearer，用户名密码使用 Basic
+func setSourceAuth(req *http.Request, auth *config.GitAuth) error {
+	if auth == nil {
+		return nil
+	}
+	if auth.Token != "" {
+		token, err := resolveSecret(auth.Token)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	if auth.Password != "" {
+		password, err := resolveSecret(auth.Password)
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(auth.Username, password)
+	}
+	return nil
+}
+
+// 在 dir 旁的临时目录中生成新内容后替换 dir，失败时保留原目录
+func replaceDir(dir string, fill func(string) error) error {
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".extract-")
+	if err != nil {
+		return err
+	}
+	if err := fill(tmpDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	return os.Rename(tmpDir, dir)
+}
+
+// 按文件头识别压缩包格式并解压到 dir
+func extractArchive(file, dir string, strip int) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	magic, _ := reader.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		return extractZip(file, dir, strip)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("解压失败: %v", err)
+		}
+		defer gz.Close()
+		return extractTar(gz, dir, strip)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return extractTar(bzip2.NewReader(reader), dir, strip)
+	}
+	return extractTar(reader, dir, strip)
+}
+
+// 压缩包内路径对应的本地路径，去掉前 strip 层目录，不能逃逸出 dir；返回空字符串表示跳过
+func archivePath(dir, name string, strip int) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("包含无效路径: %s", name)
+		}
+	}
+	parts := strings.Split(strings.Trim(path.Clean("/"+name), "/"), "/")
+	if len(parts) <= strip || parts[0] == "" {
+		return "", nil
+	}
+	return filepath.Join(dir, filepath.FromSlash(path.Join(parts[strip:]...))), nil
+}
+
+func writeArchiveFile(target string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func extractTar(r io.Reader, dir string, strip int) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("解压失败: %v", err)
+		}
+		// 只解压普通文件，目录随文件创建，链接等特殊文件跳过
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		target, err := archivePath(dir, header.Name, strip)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			continue
+		}
+		if err := writeArchiveFile(target, tr); err != nil {
+			return fmt.Errorf("解压 %s 失败: %v", header.Name, err)
+		}
+	}
+}
+
+func extractZip(file, dir string, strip int) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return fmt.Errorf("解压失败: %v", err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		target, err := archivePath(dir, f.Name, strip)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("解压 %s 失败: %v", f.Name, err)
+		}
+		err = writeArchiveFile(target, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("解压 %s 失败: %v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// s3Source 镜像另一个 S3 存储桶的前缀，只下载 ETag 变化的对象
+type s3Source struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// 解析 s3://存储桶/前缀 地址，未配置 s3.endpoint 时使用 minio 的连接配置
+func newS3Source(cfg *config.Config, repo *config.Repository) (*s3Source, error) {
+	u, err := url.Parse(repo.URL)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("无效的 s3 地址 %s，格式为 s3://存储桶/前缀", repo.URL)
+	}
+	conn := config.S3Source{
+		Endpoint:  cfg.Minio.Endpoint,
+		AccessKey: cfg.Minio.AccessKey,
+		SecretKey: cfg.Minio.SecretKey,
+		UseSSL:    cfg.Minio.UseSSL,
+	}
+	if repo.S3 != nil && repo.S3.Endpoint != "" {
+		conn = *repo.S3
+	}
+	accessKey, err := resolveSecret(conn.AccessKey)
+	if err != nil {
+		return nil, err
+	}
+	secretKey, err := resolveSecret(conn.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	client, err := minio.New(conn.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: conn.UseSSL,
+		Region: conn.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("初始化 s3 客户端失败: %v", err)
+	}
+
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3Source{client: client, bucket: u.Host, prefix: prefix}, nil
+}
+
+func (s *s3Source) fetch(ctx context.Context, dir string, state *sourceState) error {
+	objects := make(map[string]string)
+	sizes := make(map[string]int64)
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return fmt.Errorf("获取 s3 文件列表失败: %v", obj.Err)
+		}
+		if strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+		objects[obj.Key] = obj.ETag
+		sizes[obj.Key] = obj.Size
+	}
+
+	// 按对象键、ETag 和大小计算摘要
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hash := sha1.New()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s\x00%s\x00%d\n", key, objects[key], sizes[key])
+	}
+	commit := hex.EncodeToString(hash.Sum(nil))
+	if commit == state.Commit {
+		log.Printf("s3 来源未变化: s3://%s/%s", s.bucket, s.prefix)
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	local := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		target, err := archivePath(dir, strings.TrimPrefix(key, s.prefix), 0)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			continue
+		}
+		local[target] = true
+		if _, err := os.Stat(target); err == nil && state.Objects[key] == objects[key] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.client.FGetObject(ctx, s.bucket, key, target, minio.GetObjectOptions{}); err != nil {
+			return fmt.Errorf("下载 %s 失败: %v", key, err)
+		}
+	}
+
+	// 删除源中已不存在的文件
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || local[p] {
+			return err
+		}
+		return os.Remove(p)
+	})
+	if err != nil {
+		return fmt.Errorf("清理本地文件失败: %v", err)
+	}
+	state.Commit = commit
+	state.Objects = objects
+	return nil
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractArchiveRejectsTraversal(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"pkg/index.html", "pkg/../../evil"} {
+		body := []byte(name)
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg})
+		tw.Write(body)
+	}
+	tw.Close()
+
+	base := t.TempDir()
+	archive := filepath.Join(base, "site.tar")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(base, "out", "site")
+
+	err := extractArchive(archive, dir, 1)
+	if err == nil || !strings.Contains(err.Error(), "pkg/../../evil") {
+		t.Fatalf("extractArchive 应拒绝逃逸出目录的路径，实际错误: %v", err)
+	}
+	for _, p := range []string{filepath.Join(base, "evil"), filepath.Join(base, "out", "evil")} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("不应在目录外写入 %s", p)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 默认的同步状态文件路径
+const defaultStateFile = ".cache/sync-state.json"
+
+func (s *MinioService) stateFile() string {
+	if s.config.Git.StateFile != "" {
+		return s.config.Git.StateFile
+	}
+	return defaultStateFile
+}
+
+// LoadSyncState 从状态文件恢复各仓库的同步状态，文件不存在时忽略
+func (s *MinioService) LoadSyncState() error {
+	data, err := os.ReadFile(s.stateFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("读取同步状态文件失败: %v", err)
+	}
+
+	var statuses map[string]*SyncStatus
+	if err := json.Unmarshal(data, &statuses); err != nil {
+		return fmt.Errorf("解析同步状态文件失败: %v", err)
+	}
+
+	// 存储中已没有发布的内容时（内存存储重启、本地目录被删除），持久化的提交不再可信，
+	// 清除后下次同步完整上传，而不是因提交未变化跳过上传
+	for minioPath, status := range statuses {
+		if status.Commit != "" && s.publishedEmpty(minioPath) {
+			log.Printf("仓库 %s 已发布的内容为空，忽略记录的提交 %s", minioPath, shortCommit(status.Commit))
+			status.Commit = ""
+		}
+	}
+
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	for minioPath, status := range statuses {
+		// 上次退出时仍在进行中的同步视为失败
+		if status.Status == "syncing" {
+			status.Status = "error"
+			status.Error = "服务重启时同步未完成"
+		}
+		s.syncStatus[minioPath] = status
+	}
+	log.Printf("已恢复 %d 个仓库的同步状态", len(statuses))
+	return nil
+}
+
+// 仓库在存储中是否没有任何已发布的文件，无法确定时返回 false
+func (s *MinioService) publishedEmpty(minioPath string) bool {
+	if s.config.Storage.Driver == DriverMemory {
+		return true
+	}
+	live, err := s.livePrefix(minioPath)
+	if err != nil {
+		return false
+	}
+	objects, err := s.repoObjects(context.Background(), minioPath, live)
+	if err != nil {
+		log.Printf("检查仓库 %s 已发布的内容失败: %v", minioPath, err)
+		return false
+	}
+	return len(objects) == 0
+}
+
+// 将当前同步状态写入状态文件，先写临时文件再重命名以避免写入中断
+func (s *MinioService) saveSyncState() {
+	s.statusMutex.RLock()
+	data, err := json.MarshalIndent(s.syncStatus, "", "  ")
+	s.statusMutex.RUnlock()
+	if err != nil {
+		log.Printf("序列化同步状态失败: %v", err)
+		return
+	}
+
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
+	path := s.stateFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("创建状态文件目录失败: %v", err)
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("写入同步状态文件失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Printf("保存同步状态文件失败: %v", err)
+	}
+}
+
+// 记录一次同步的最终结果并持久化
+func (s *MinioService) completeSync(minioPath string, started time.Time, commit string, err error, cancelled bool) {
+	now := time.Now()
+	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		previous := status.Status
+		status.Stage = ""
+		status.DurationMs = now.Sub(started).Milliseconds()
+		var partial *PartialSyncError
+		switch {
+		case cancelled:
+			status.Status = "cancelled"
+		case errors.As(err, &partial):
+			// 部分文件失败时不更新已发布的提交，下次同步会重新处理这些文件
+			status.Status = "partial"
+			if status.Uploaded+status.Skipped+status.Deleted == 0 {
+				status.Status = "error"
+			}
+			status.Error = err.Error()
+			status.LastFailure = now
+		case err != nil:
+			status.Status = "error"
+			status.Error = err.Error()
+			status.LastFailure = now
+		default:
+			status.Error = ""
+			status.LastSuccess = now
+			status.Commit = commit
+		}
+		// 成功时状态仍为 idle，不会触发状态变化事件，需单独通知订阅者
+		if status.Status == previous {
+			s.publishStatus(minioPath, status)
+		}
+	})
+	s.saveSyncState()
+}
+
+// 获取最后一次同步的时间，用于重启后继续原有的同步计划
+func (s *MinioService) lastSyncTime(minioPath string) time.Time {
+	s.statusMutex.RLock()
+	defer s.statusMutex.RUnlock()
+
+	if status, exists := s.syncStatus[minioPath]; exists {
+		return status.LastSync
+	}
+	return time.Time{}
+}
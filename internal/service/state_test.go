@@ -0,0 +1,49 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+func writeStateFile(t *testing.T, s *MinioService, data string) {
+	t.Helper()
+	if err := os.WriteFile(s.stateFile(), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadSyncStateIgnoresCommitWithoutPublishedFiles(t *testing.T) {
+	// 内存存储重启后为空，记录的提交不再可信
+	s := newMemoryService(t, "docs")
+	writeStateFile(t, s, `{"docs": {"status": "idle", "commit": "abc123"}}`)
+	if err := s.LoadSyncState(); err != nil {
+		t.Fatal(err)
+	}
+	if commit := s.publishedCommit("docs"); commit != "" {
+		t.Errorf("内存存储重启后 publishedCommit = %q，期望为空", commit)
+	}
+
+	// 本地存储：目录被删除时忽略记录的提交，仍有内容时保留
+	root := t.TempDir()
+	cfg := &config.Config{Storage: config.StorageConfig{Driver: DriverLocal, Path: root}}
+	cfg.Git.StateFile = filepath.Join(t.TempDir(), "sync-state.json")
+	cfg.Git.Repositories = []config.Repository{{MinioPath: "docs"}, {MinioPath: "blog"}}
+	s, err := NewMinioService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putObject(t, s, "blog/index.html", "blog")
+	writeStateFile(t, s, `{"docs": {"status": "idle", "commit": "abc123"}, "blog": {"status": "idle", "commit": "def456"}}`)
+	if err := s.LoadSyncState(); err != nil {
+		t.Fatal(err)
+	}
+	if commit := s.publishedCommit("docs"); commit != "" {
+		t.Errorf("docs 没有已发布的文件，publishedCommit = %q，期望为空", commit)
+	}
+	if commit := s.publishedCommit("blog"); commit != "def456" {
+		t.Errorf("blog 的 publishedCommit = %q，期望 def456", commit)
+	}
+}
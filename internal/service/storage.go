@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 存储驱动
+const (
+	DriverMinio  = "minio"
+	DriverLocal  = "local"
+	DriverMemory = "memory"
+)
+
+// ErrNotSupported 存储驱动不支持该操作（如本地存储无法生成预签名URL）
+var ErrNotSupported = errors.New("存储驱动不支持该操作")
+
+// ObjectInfo 对象信息
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+	ContentType  string
+	Metadata     map[string]string // 自定义元数据，如同步时写入的 Sha1
+}
+
+// Object 对象内容，支持 Seek 以便按 Range 读取任意区间
+type Object interface {
+	io.ReadSeekCloser
+	Info() ObjectInfo
+}
+
+// PutOptions 上传选项
+type PutOptions struct {
+	ContentType string            // 为空时根据扩展名推断
+	Metadata    map[string]string // 自定义元数据
+}
+
+// PresignOptions 预签名选项，响应头为空时不覆盖对象自身的设置
+type PresignOptions struct {
+	Expiry             time.Duration
+	ContentDisposition string // 访问时返回的 Content-Disposition
+	CacheControl       string // 访问时返回的 Cache-Control
+}
+
+// Storage 存储后端
+// bucket 为配置中的存储桶名称，为空时表示默认存储（minio.bucket）；
+// 对象不存在时 Stat、Get 返回的错误满足 errors.Is(err, os.ErrNotExist)
+type Storage interface {
+	// List 递归列出前缀下的所有对象，按键排序
+	List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error)
+	Stat(ctx context.Context, bucket, key string) (ObjectInfo, error)
+	Get(ctx context.Context, bucket, key string) (Object, error)
+	Put(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) (ObjectInfo, error)
+	// Copy 在同一存储桶内复制对象，保留内容类型和元数据
+	Copy(ctx context.Context, bucket, srcKey, dstKey string) error
+	// SetContentType 修改已有对象的内容类型，保留内容和自定义元数据
+	SetContentType(ctx context.Context, bucket, key, contentType string) error
+	// Remove 删除对象，对象不存在时不返回错误
+	Remove(ctx context.Context, bucket, key string) error
+	// Presign 生成带有效期的直接访问地址，不支持时返回 ErrNotSupported
+	Presign(ctx context.Context, bucket, key string, opts PresignOptions) (string, error)
+	// PublicURL 生成不带签名的访问地址，baseURL 对应存储桶的根目录，为空时使用存储服务的地址；不支持时返回 ErrNotSupported
+	PublicURL(ctx context.Context, bucket, key, baseURL string) (string, error)
+}
+
+// 拼接地址前缀和对象键，对象键按路径分段转义
+func joinURL(baseURL, key string) string {
+	segments := strings.Split(key, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/" + strings.Join(segments, "/")
+}
+
+var (
+	_ Storage = (*MinioService)(nil)
+	_ Storage = (*LocalStorage)(nil)
+	_ Storage = (*MemoryStorage)(nil)
+)
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 本地存储根目录下的布局：默认存储和各存储桶的对象、元数据分别位于互不重叠的目录中，
+// 对象键与存储桶名称相同时也不会互相覆盖
+const (
+	localDefaultDir = "default" // 默认存储的对象
+	localBucketsDir = "buckets" // 其他存储桶的对象，每个存储桶一个子目录
+	localMetaDir    = ".meta"   // 元数据，按 default 和 buckets/{name} 分开保存
+	localTmpDir     = ".tmp"    // 上传中的临时文件
+)
+
+// LocalStorage 使用本地目录作为存储后端
+// 默认存储对应根目录下的 default 目录，其他存储桶对应 buckets 下同名的子目录
+type LocalStorage struct {
+	root string
+}
+
+// 本地对象的元数据，保存在 .meta 目录下的同名 JSON 文件中
+type localMeta struct {
+	ContentType string            `json:"contentType,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+type localObject struct {
+	*os.File
+	info ObjectInfo
+}
+
+func (o *localObject) Info() ObjectInfo {
+	return o.info
+}
+
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{root: filepath.Clean(root)}
+}
+
+// 存储桶相对于根目录（或元数据目录）的子目录
+func localBucketPath(bucket string) string {
+	if bucket == "" {
+		return localDefaultDir
+	}
+	return filepath.Join(localBucketsDir, filepath.Base(filepath.Clean("/"+bucket)))
+}
+
+// 存储桶对应的目录
+func (l *LocalStorage) bucketDir(bucket string) string {
+	return filepath.Join(l.root, localBucketPath(bucket))
+}
+
+// 对象键对应的文件路径，键会被规范化，不能逃逸出存储桶目录
+func (l *LocalStorage) objectPath(bucket, key string) (string, error) {
+	clean := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if clean == "" {
+		return "", fmt.Errorf("无效的对象路径: %q", key)
+	}
+	return filepath.Join(l.bucketDir(bucket), filepath.FromSlash(clean)), nil
+}
+
+func (l *LocalStorage) metaPath(bucket, key string) string {
+	clean := strings.TrimPrefix(path.Clean("/"+key), "/")
+	return filepath.Join(l.root, localMetaDir, localBucketPath(bucket), filepath.FromSlash(clean)+".json")
+}
+
+func (l *LocalStorage) readMeta(bucket, key string) localMeta {
+	var meta localMeta
+	if data, err := os.ReadFile(l.metaPath(bucket, key)); err == nil {
+		json.Unmarshal(data, &meta)
+	}
+	return meta
+}
+
+func (l *LocalStorage) objectInfo(bucket, key string, fi os.FileInfo) ObjectInfo {
+	meta := l.readMeta(bucket, key)
+	if meta.ContentType == "" {
+		meta.ContentType = getContentType(key)
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         fi.Size(),
+		LastModified: fi.ModTime(),
+		ETag:         fmt.Sprintf("%x-%x", fi.ModTime().UnixNano(), fi.Size()),
+		ContentType:  meta.ContentType,
+		Metadata:     meta.Metadata,
+	}
+}
+
+func (l *LocalStorage) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	base := l.bucketDir(bucket)
+	var objects []ObjectInfo
+
+	err := filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == base {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if p == base {
+				return nil
+			}
+			// 跳过与前缀不相交的目录
+			if !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(key, prefix) || !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, l.objectInfo(bucket, key, fi))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (l *LocalStorage) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	p, err := l.objectPath(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if fi.IsDir() {
+		return ObjectInfo{}, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+	}
+	return l.objectInfo(bucket, key, fi), nil
+}
+
+func (l *LocalStorage) Get(ctx context.Context, bucket, key string) (Object, error) {
+	info, err := l.Stat(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	p, _ := l.objectPath(bucket, key)
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	return &localObject{File: file, info: info}, nil
+}
+
+// Put 先写入临时文件再重命名，读取方不会看到写了一半的文件
+func (l *LocalStorage) Put(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) (ObjectInfo, error) {
+	p, err := l.objectPath(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	tmpDir := filepath.Join(l.root, localTmpDir)
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return ObjectInfo{}, fmt.Errorf("创建目录失败 %s: %v", tmpDir, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return ObjectInfo{}, fmt.Errorf("创建目录失败 %s: %v", filepath.Dir(p), err)
+	}
+
+	tmp, err := os.CreateTemp(tmpDir, "upload-*")
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if size >= 0 && written != size {
+		return ObjectInfo{}, fmt.Errorf("写入大小不一致: 期望 %d, 实际 %d", size, written)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return ObjectInfo{}, err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	if err := l.writeMeta(bucket, key, opts); err != nil {
+		return ObjectInfo{}, err
+	}
+	return l.Stat(ctx, bucket, key)
+}
+
+func (l *LocalStorage) writeMeta(bucket, key string, opts PutOptions) error {
+	metaPath := l.metaPath(bucket, key)
+	if opts.ContentType == "" && len(opts.Metadata) == 0 {
+		os.Remove(metaPath)
+		return nil
+	}
+	data, err := json.Marshal(localMeta{ContentType: opts.ContentType, Metadata: opts.Metadata})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath, data, 0644)
+}
+
+func (l *LocalStorage) Copy(ctx context.Context, bucket, srcKey, dstKey string) error {
+	obj, err := l.Get(ctx, bucket, srcKey)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	info := obj.Info()
+	meta := l.readMeta(bucket, srcKey)
+	_, err = l.Put(ctx, bucket, dstKey, obj, info.Size, PutOptions{ContentType: meta.ContentType, Metadata: meta.Metadata})
+	return err
+}
+
+func (l *LocalStorage) SetContentType(ctx context.Context, bucket, key, contentType string) error {
+	if _, err := l.Stat(ctx, bucket, key); err != nil {
+		return err
+	}
+	meta := l.readMeta(bucket, key)
+	return l.writeMeta(bucket, key, PutOptions{ContentType: contentType, Metadata: meta.Metadata})
+}
+
+func (l *LocalStorage) Remove(ctx context.Context, bucket, key string) error {
+	p, err := l.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	os.Remove(l.metaPath(bucket, key))
+
+	// 清理空的上级目录，与对象存储中目录随对象消失的行为保持一致
+	base := l.bucketDir(bucket)
+	for dir := filepath.Dir(p); dir != base && strings.HasPrefix(dir, base); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (l *LocalStorage) Presign(ctx context.Context, bucket, key string, opts PresignOptions) (string, error) {
+	return "", ErrNotSupported
+}
+
+// 只能使用指向存储目录的外部地址，如 CDN 或静态文件服务器
+func (l *LocalStorage) PublicURL(ctx context.Context, bucket, key, baseURL string) (string, error) {
+	if baseURL == "" {
+		return "", ErrNotSupported
+	}
+	return joinURL(baseURL, key), nil
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+func TestLocalStorageBucketsDoNotOverlapDefault(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocalStorage(t.TempDir())
+
+	put := func(bucket, key, body, contentType, sha1 string) {
+		t.Helper()
+		_, err := l.Put(ctx, bucket, key, bytes.NewReader([]byte(body)), int64(len(body)), PutOptions{
+			ContentType: contentType,
+			Metadata:    map[string]string{"Sha1": sha1},
+		})
+		if err != nil {
+			t.Fatalf("写入 %q/%s 失败: %v", bucket, key, err)
+		}
+	}
+	// 默认存储中的 assets/logo.svg 与存储桶 assets 中的 logo.svg 相对路径相同
+	put("assets", "logo.svg", "bucket", "image/svg+xml", "bucket-sha1")
+	put("", "assets/logo.svg", "default", "text/plain", "default-sha1")
+
+	check := func(bucket, key, body, contentType, sha1 string) {
+		t.Helper()
+		obj, err := l.Get(ctx, bucket, key)
+		if err != nil {
+			t.Fatalf("读取 %q/%s 失败: %v", bucket, key, err)
+		}
+		defer obj.Close()
+		data, _ := io.ReadAll(obj)
+		info := obj.Info()
+		if string(data) != body || info.ContentType != contentType || info.Metadata["Sha1"] != sha1 {
+			t.Errorf("%q/%s = %q %s %s，期望 %q %s %s", bucket, key, data, info.ContentType, info.Metadata["Sha1"], body, contentType, sha1)
+		}
+	}
+	check("assets", "logo.svg", "bucket", "image/svg+xml", "bucket-sha1")
+	check("", "assets/logo.svg", "default", "text/plain", "default-sha1")
+
+	// 默认存储的列表不包含存储桶中的对象
+	objects, err := l.List(ctx, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != "assets/logo.svg" {
+		t.Errorf("默认存储的列表 = %v，期望只有 assets/logo.svg", objects)
+	}
+
+	// 删除默认存储中的对象不影响存储桶
+	if err := l.Remove(ctx, "", "assets/logo.svg"); err != nil {
+		t.Fatal(err)
+	}
+	check("assets", "logo.svg", "bucket", "image/svg+xml", "bucket-sha1")
+}
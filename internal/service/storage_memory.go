@@ -0,0 +1,171 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage 内存存储后端，用于测试和本地开发，进程退出后数据丢失
+type MemoryStorage struct {
+	mutex   sync.RWMutex
+	objects map[string]map[string]*memoryEntry // 存储桶 -> 对象键 -> 对象
+}
+
+type memoryEntry struct {
+	data []byte
+	info ObjectInfo
+}
+
+type memoryObject struct {
+	*bytes.Reader
+	info ObjectInfo
+}
+
+func (o *memoryObject) Info() ObjectInfo {
+	return o.info
+}
+
+func (o *memoryObject) Close() error {
+	return nil
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{objects: make(map[string]map[string]*memoryEntry)}
+}
+
+func (m *MemoryStorage) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var objects []ObjectInfo
+	for key, entry := range m.objects[bucket] {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, entry.info)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (m *MemoryStorage) entry(bucket, key string) (*memoryEntry, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	entry, ok := m.objects[bucket][key]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: bucket + "/" + key, Err: fs.ErrNotExist}
+	}
+	return entry, nil
+}
+
+func (m *MemoryStorage) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	entry, err := m.entry(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return entry.info, nil
+}
+
+func (m *MemoryStorage) Get(ctx context.Context, bucket, key string) (Object, error) {
+	entry, err := m.entry(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	// 写入时总是替换整个条目，读取期间无需加锁
+	return &memoryObject{Reader: bytes.NewReader(entry.data), info: entry.info}, nil
+}
+
+func (m *MemoryStorage) Put(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) (ObjectInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return ObjectInfo{}, fmt.Errorf("写入大小不一致: 期望 %d, 实际 %d", size, len(data))
+	}
+
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = getContentType(key)
+	}
+	metadata := make(map[string]string, len(opts.Metadata))
+	for k, v := range opts.Metadata {
+		metadata[k] = v
+	}
+	sum := md5.Sum(data)
+	info := ObjectInfo{
+		Key:          key,
+		Size:         int64(len(data)),
+		LastModified: time.Now(),
+		ETag:         hex.EncodeToString(sum[:]),
+		ContentType:  contentType,
+		Metadata:     metadata,
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.objects[bucket] == nil {
+		m.objects[bucket] = make(map[string]*memoryEntry)
+	}
+	m.objects[bucket][key] = &memoryEntry{data: data, info: info}
+	return info, nil
+}
+
+func (m *MemoryStorage) Copy(ctx context.Context, bucket, srcKey, dstKey string) error {
+	entry, err := m.entry(bucket, srcKey)
+	if err != nil {
+		return err
+	}
+	info := entry.info
+	info.Key = dstKey
+	info.LastModified = time.Now()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.objects[bucket][dstKey] = &memoryEntry{data: entry.data, info: info}
+	return nil
+}
+
+func (m *MemoryStorage) SetContentType(ctx context.Context, bucket, key, contentType string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry, ok := m.objects[bucket][key]
+	if !ok {
+		return &fs.PathError{Op: "stat", Path: bucket + "/" + key, Err: fs.ErrNotExist}
+	}
+	// 条目读取时不加锁，替换为新条目而不是原地修改
+	info := entry.info
+	info.ContentType = contentType
+	m.objects[bucket][key] = &memoryEntry{data: entry.data, info: info}
+	return nil
+}
+
+func (m *MemoryStorage) Remove(ctx context.Context, bucket, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.objects[bucket], key)
+	return nil
+}
+
+func (m *MemoryStorage) Presign(ctx context.Context, bucket, key string, opts PresignOptions) (string, error) {
+	return "", ErrNotSupported
+}
+
+// 只能使用指向存储目录的外部地址，如 CDN 或静态文件服务器
+func (m *MemoryStorage) PublicURL(ctx context.Context, bucket, key, baseURL string) (string, error) {
+	if baseURL == "" {
+		return "", ErrNotSupported
+	}
+	return joinURL(baseURL, key), nil
+}
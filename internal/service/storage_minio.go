@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Minio 对象，打开时已获取对象信息
+type minioObject struct {
+	*minio.Object
+	info ObjectInfo
+}
+
+func (o *minioObject) Info() ObjectInfo {
+	return o.info
+}
+
+// 查找存储桶对应的客户端、桶名和基础路径，bucket 为空时使用默认存储
+func (s *MinioService) bucketTarget(bucketName string) (*minio.Client, string, string, error) {
+	if bucketName == "" {
+		return s.client, s.config.Minio.Bucket, "", nil
+	}
+	for i := range s.config.Buckets {
+		if s.config.Buckets[i].Name == bucketName {
+			bucket := &s.config.Buckets[i]
+			return s.buckets[bucketName], bucket.BucketName, bucket.BasePath, nil
+		}
+	}
+	return nil, "", "", fmt.Errorf("bucket not found: %s", bucketName)
+}
+
+// 对象不存在时转换为 fs.ErrNotExist
+func minioError(op, key string, err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket":
+		return &fs.PathError{Op: op, Path: key, Err: fs.ErrNotExist}
+	}
+	return err
+}
+
+func objectInfoFromMinio(key string, info minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         info.Size,
+		LastModified: info.LastModified,
+		ETag:         info.ETag,
+		ContentType:  info.ContentType,
+		Metadata:     info.UserMetadata,
+	}
+}
+
+func (s *MinioService) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	client, bucketName, basePath, err := s.bucketTarget(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	// 带基础路径时，返回的键需去掉基础路径
+	fullPrefix := prefix
+	if basePath != "" {
+		fullPrefix = strings.TrimSuffix(basePath, "/") + "/" + prefix
+	}
+
+	var objects []ObjectInfo
+	opts := minio.ListObjectsOptions{
+		Prefix:    fullPrefix,
+		Recursive: true,
+	}
+	for object := range client.ListObjects(ctx, bucketName, opts) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		key := object.Key
+		if basePath != "" {
+			key = strings.TrimPrefix(key, strings.TrimSuffix(basePath, "/")+"/")
+		}
+		objects = append(objects, objectInfoFromMinio(key, object))
+	}
+	return objects, nil
+}
+
+func (s *MinioService) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	client, bucketName, basePath, err := s.bucketTarget(bucket)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := client.StatObject(ctx, bucketName, path.Join(basePath, key), minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, minioError("stat", key, err)
+	}
+	return objectInfoFromMinio(key, info), nil
+}
+
+func (s *MinioService) Get(ctx context.Context, bucket, key string) (Object, error) {
+	client, bucketName, basePath, err := s.bucketTarget(bucket)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := client.GetObject(ctx, bucketName, path.Join(basePath, key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, minioError("get", key, err)
+	}
+	// GetObject 不会发起请求，通过 Stat 确认对象存在
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, minioError("get", key, err)
+	}
+	return &minioObject{Object: obj, info: objectInfoFromMinio(key, info)}, nil
+}
+
+func (s *MinioService) Put(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) (ObjectInfo, error) {
+	client, bucketName, basePath, err := s.bucketTarget(bucket)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = getContentType(key)
+	}
+	info, err := client.PutObject(ctx, bucketName, path.Join(basePath, key), reader, size, minio.PutObjectOptions{
+		ContentType:  contentType,
+		UserMetadata: opts.Metadata,
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         info.Size,
+		LastModified: info.LastModified,
+		ETag:         info.ETag,
+		ContentType:  contentType,
+		Metadata:     opts.Metadata,
+	}, nil
+}
+
+func (s *MinioService) Copy(ctx context.Context, bucket, srcKey, dstKey string) error {
+	client, bucketName, basePath, err := s.bucketTarget(bucket)
+	if err != nil {
+		return err
+	}
+	_, err = client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: bucketName, Object: path.Join(basePath, dstKey)},
+		minio.CopySrcOptions{Bucket: bucketName, Object: path.Join(basePath, srcKey)},
+	)
+	if err != nil {
+		return minioError("copy", srcKey, err)
+	}
+	return nil
+}
+
+func (s *MinioService) SetContentType(ctx context.Context, bucket, key, contentType string) error {
+	client, bucketName, basePath, err := s.bucketTarget(bucket)
+	if err != nil {
+		return err
+	}
+	object := path.Join(basePath, key)
+	info, err := client.StatObject(ctx, bucketName, object, minio.StatObjectOptions{})
+	if err != nil {
+		return minioError("stat", key, err)
+	}
+	// 复制到自身并替换元数据，Content-Type 作为标准请求头发送
+	metadata := map[string]string{"Content-Type": contentType}
+	for k, v := range info.UserMetadata {
+		metadata[k] = v
+	}
+	_, err = client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: bucketName, Object: object, UserMetadata: metadata, ReplaceMetadata: true},
+		minio.CopySrcOptions{Bucket: bucketName, Object: object, MatchETag: info.ETag},
+	)
+	if err != nil {
+		return minioError("copy", key, err)
+	}
+	return nil
+}
+
+func (s *MinioService) Remove(ctx context.Context, bucket, key string) error {
+	client, bucketName, basePath, err := s.bucketTarget(bucket)
+	if err != nil {
+		return err
+	}
+	return client.RemoveObject(ctx, bucketName, path.Join(basePath, key), minio.RemoveObjectOptions{})
+}
+
+func (s *MinioService) Presign(ctx context.Context, bucket, key string, opts PresignOptions) (string, error) {
+	client, bucketName, basePath, err := s.bucketTarget(bucket)
+	if err != nil {
+		return "", err
+	}
+	// 通过 response-* 参数覆盖访问时返回的响应头
+	reqParams := make(url.Values)
+	if opts.ContentDisposition != "" {
+		reqParams.Set("response-content-disposition", opts.ContentDisposition)
+	}
+	if opts.CacheControl != "" {
+		reqParams.Set("response-cache-control", opts.CacheControl)
+	}
+	presignedURL, err := client.PresignedGetObject(ctx, bucketName, path.Join(basePath, key), opts.Expiry, reqParams)
+	if err != nil {
+		if s.config.Logs.PresignLog {
+			log.Printf("PreSign failed: %s: %v", key, err)
+		}
+		return "", err
+	}
+	if s.config.Logs.PresignLog {
+		log.Printf("PreSign success: %s -> %s", key, presignedURL.String())
+	}
+	return presignedURL.String(), nil
+}
+
+func (s *MinioService) PublicURL(ctx context.Context, bucket, key, baseURL string) (string, error) {
+	client, bucketName, basePath, err := s.bucketTarget(bucket)
+	if err != nil {
+		return "", err
+	}
+	if baseURL == "" {
+		// 存储桶允许匿名读取时可以直接访问的路径形式地址
+		baseURL = client.EndpointURL().String() + "/" + bucketName
+		return joinURL(baseURL, path.Join(basePath, key)), nil
+	}
+	return joinURL(baseURL, key), nil
+}
@@ -0,0 +1,574 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+// 同步触发来源
+const (
+	TriggerStartup  = "startup"
+	TriggerSchedule = "schedule"
+	TriggerWebhook  = "webhook"
+	TriggerAPI      = "api"
+	TriggerRollback = "rollback"
+	TriggerConfirm  = "confirm" // 确认超过删除限制的同步
+	TriggerCLI      = "cli"
+)
+
+// 手动触发的同步遍历整个目录，并且可以发布回滚前的提交
+func manualTrigger(triggeredBy string) bool {
+	return strings.HasPrefix(triggeredBy, TriggerAPI) || triggeredBy == TriggerCLI
+}
+
+// 同步任务
+type syncTask struct {
+	repo        *config.Repository
+	triggeredBy string   // 触发来源
+	started     bool     // 是否已由工作线程开始执行
+	rollback    *Version // 不为空时回滚到该版本而不是同步
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+// SyncManager 管理仓库同步工作池
+type SyncManager struct {
+	config       *config.Config
+	gitService   *GitService
+	minioService *MinioService
+	taskChan     chan *syncTask
+	tasksMutex   sync.Mutex
+	tasks        map[string][]*syncTask // 排队中和执行中的任务，用于取消
+	repoLocks    map[string]*sync.Mutex // 同一仓库的任务依次执行
+}
+
+func NewSyncManager(config *config.Config, gitService *GitService, minioService *MinioService) *SyncManager {
+	return &SyncManager{
+		config:       config,
+		gitService:   gitService,
+		minioService: minioService,
+		tasks:        make(map[string][]*syncTask),
+		repoLocks:    make(map[string]*sync.Mutex),
+	}
+}
+
+// Start 启动同步工作池
+func (m *SyncManager) Start(numWorkers int) {
+	m.taskChan = make(chan *syncTask)
+	for i := 0; i < numWorkers; i++ {
+		go m.worker()
+	}
+}
+
+// Running 返回工作池是否已启动（API-only 模式下不启动）
+func (m *SyncManager) Running() bool {
+	return m.taskChan != nil
+}
+
+// Enqueue 添加同步任务，不会阻塞调用方
+// 仓库已有排队中的任务时不再重复添加；定时触发在仓库同步进行中时同样跳过，
+// 而 Webhook 和 API 触发会在当前同步结束后再执行一次。返回是否已添加
+func (m *SyncManager) Enqueue(repo *config.Repository, triggeredBy string) bool {
+	return m.enqueue(&syncTask{repo: repo, triggeredBy: triggeredBy, ctx: context.Background()})
+}
+
+// EnqueueRollback 添加回滚任务，与同步任务共用队列，仓库已有排队中的任务时返回 false
+func (m *SyncManager) EnqueueRollback(repo *config.Repository, version *Version, triggeredBy string) bool {
+	return m.enqueue(&syncTask{repo: repo, triggeredBy: triggeredBy, rollback: version, ctx: context.Background()})
+}
+
+// EnqueueConfirmed 添加允许超过删除限制的同步任务，用于确认因删除过多而中止的同步
+func (m *SyncManager) EnqueueConfirmed(repo *config.Repository, triggeredBy string) bool {
+	return m.enqueue(&syncTask{repo: repo, triggeredBy: triggeredBy, ctx: ConfirmDeletions(context.Background())})
+}
+
+// 添加任务，task.ctx 为任务 ctx 的父级
+func (m *SyncManager) enqueue(task *syncTask) bool {
+	minioPath := task.repo.MinioPath
+	m.tasksMutex.Lock()
+	for _, t := range m.tasks[minioPath] {
+		if t.ctx.Err() != nil {
+			continue
+		}
+		if !t.started || task.triggeredBy == TriggerSchedule || task.triggeredBy == TriggerStartup {
+			m.tasksMutex.Unlock()
+			return false
+		}
+	}
+
+	task.ctx, task.cancel = context.WithCancel(task.ctx)
+	m.tasks[minioPath] = append(m.tasks[minioPath], task)
+	m.tasksMutex.Unlock()
+
+	go func() { m.taskChan <- task }()
+	return true
+}
+
+// Cancel 取消指定仓库排队中和执行中的同步任务，返回取消的任务数
+func (m *SyncManager) Cancel(minioPath string) int {
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+
+	tasks := m.tasks[minioPath]
+	for _, task := range tasks {
+		task.cancel()
+	}
+	return len(tasks)
+}
+
+// Status 获取仓库的同步状态
+func (m *SyncManager) Status(minioPath string) *SyncStatus {
+	return m.minioService.GetSyncStatus(minioPath)
+}
+
+// SubscribeEvents 订阅同步事件，参见 MinioService.SubscribeSyncEvents
+func (m *SyncManager) SubscribeEvents(minioPaths []string) (<-chan SyncEvent, func()) {
+	return m.minioService.SubscribeSyncEvents(minioPaths)
+}
+
+// Versions 列出仓库的版本记录
+func (m *SyncManager) Versions(ctx context.Context, minioPath string) ([]Version, error) {
+	return m.minioService.ListVersions(ctx, minioPath)
+}
+
+// FindVersion 按版本 ID 或提交查找版本
+func (m *SyncManager) FindVersion(ctx context.Context, minioPath, ref string) (*Version, error) {
+	return m.minioService.FindVersion(ctx, minioPath, ref)
+}
+
+// FindRepository 根据 minioPath 查找仓库配置
+func (m *SyncManager) FindRepository(minioPath string) *config.Repository {
+	for i := range m.config.Git.Repositories {
+		if m.config.Git.Repositories[i].MinioPath == minioPath {
+			return &m.config.Git.Repositories[i]
+		}
+	}
+	return nil
+}
+
+// 任务结束后移除记录
+func (m *SyncManager) finish(task *syncTask) {
+	task.cancel()
+
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+
+	tasks := m.tasks[task.repo.MinioPath]
+	for i, t := range tasks {
+		if t == task {
+			tasks = append(tasks[:i], tasks[i+1:]...)
+			break
+		}
+	}
+	if len(tasks) == 0 {
+		delete(m.tasks, task.repo.MinioPath)
+	} else {
+		m.tasks[task.repo.MinioPath] = tasks
+	}
+}
+
+// RunNow 立即同步仓库并等待完成，不经过工作池，用于命令行单次同步
+func (m *SyncManager) RunNow(ctx context.Context, repo *config.Repository, confirmDeletions bool) error {
+	if confirmDeletions {
+		ctx = ConfirmDeletions(ctx)
+	}
+	task := &syncTask{repo: repo, triggeredBy: TriggerCLI, started: true}
+	task.ctx, task.cancel = context.WithCancel(ctx)
+	defer task.cancel()
+
+	lock := m.repoLock(repo.MinioPath)
+	lock.Lock()
+	m.run(task)
+	lock.Unlock()
+
+	status := m.Status(repo.MinioPath)
+	switch {
+	case status.Status == "idle":
+		return nil
+	case status.Error != "":
+		return errors.New(status.Error)
+	}
+	return fmt.Errorf("同步未完成: %s", status.Status)
+}
+
+// DryRun 拉取仓库并与当前发布的内容比较，返回计划上传和删除的文件，不修改存储
+func (m *SyncManager) DryRun(ctx context.Context, repo *config.Repository) (*SyncPlan, error) {
+	lock := m.repoLock(repo.MinioPath)
+	lock.Lock()
+	defer lock.Unlock()
+
+	result, err := m.checkout(ctx, repo, false)
+	if err != nil {
+		return nil, err
+	}
+	if repo.Build != nil {
+		if err := m.build(ctx, repo, result.Commit, false); err != nil {
+			return nil, err
+		}
+	}
+	plan, err := m.minioService.PlanDirectory(ctx, repo.LocalPath, repo.MinioPath)
+	if err != nil {
+		return nil, err
+	}
+	plan.Commit = result.Commit
+	return plan, nil
+}
+
+// Restamp 按当前规则重新设置仓库已上传文件的 Content-Type，与同步任务互斥
+func (m *SyncManager) Restamp(ctx context.Context, repo *config.Repository, dryRun bool) (*RestampResult, error) {
+	lock := m.repoLock(repo.MinioPath)
+	lock.Lock()
+	defer lock.Unlock()
+
+	return m.minioService.RestampRepository(ctx, repo.MinioPath, dryRun)
+}
+
+// 获取仓库的执行锁
+func (m *SyncManager) repoLock(minioPath string) *sync.Mutex {
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+
+	lock, ok := m.repoLocks[minioPath]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.repoLocks[minioPath] = lock
+	}
+	return lock
+}
+
+func (m *SyncManager) worker() {
+	for task := range m.taskChan {
+		m.tasksMutex.Lock()
+		task.started = true
+		m.tasksMutex.Unlock()
+
+		lock := m.repoLock(task.repo.MinioPath)
+		lock.Lock()
+		m.run(task)
+		lock.Unlock()
+		m.finish(task)
+	}
+}
+
+func (m *SyncManager) run(task *syncTask) {
+	minioPath := task.repo.MinioPath
+
+	// 排队期间已被取消
+	if task.ctx.Err() != nil {
+		log.Printf("同步任务已取消: %s", minioPath)
+		m.minioService.updateSyncStatus(minioPath, func(status *SyncStatus) {
+			status.Status = "cancelled"
+			status.TriggeredBy = task.triggeredBy
+		})
+		return
+	}
+
+	m.minioService.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.Status = "syncing"
+		status.TriggeredBy = task.triggeredBy
+	})
+
+	started := time.Now()
+	var commit string
+	var err error
+	if task.rollback != nil {
+		commit, err = m.rollback(task)
+	} else {
+		commit, err = m.sync(task)
+	}
+	m.minioService.completeSync(minioPath, started, commit, err, task.ctx.Err() != nil)
+}
+
+// 回滚到指定版本，返回该版本的提交
+func (m *SyncManager) rollback(task *syncTask) (string, error) {
+	minioPath := task.repo.MinioPath
+	previous := m.minioService.publishedCommit(minioPath)
+	if err := m.minioService.Rollback(task.ctx, minioPath, task.rollback); err != nil {
+		log.Printf("回滚失败 %s: %v", minioPath, err)
+		return "", err
+	}
+
+	log.Printf("已回滚 %s 到版本 %s", minioPath, task.rollback.ID)
+	m.minioService.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.Version = task.rollback.ID
+		if previous != task.rollback.Commit {
+			status.RolledBackFrom = previous
+		}
+	})
+	return task.rollback.Commit, nil
+}
+
+// 拉取仓库、子模块和 LFS 对象，非 git 来源下载到本地目录；report 为 true 时在同步状态中记录当前阶段
+func (m *SyncManager) checkout(ctx context.Context, repo *config.Repository, report bool) (*SyncResult, error) {
+	stage := func(name string) {
+		if report {
+			m.minioService.updateSyncStatus(repo.MinioPath, func(status *SyncStatus) {
+				status.Stage = name
+			})
+		}
+	}
+
+	stage("fetch")
+	if isSourceRepo(repo) {
+		return m.fetchSource(ctx, repo)
+	}
+	result, err := m.gitService.SyncRepository(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	if repo.Submodules {
+		stage("submodules")
+		if err := m.gitService.UpdateSubmodules(ctx, repo); err != nil {
+			return nil, err
+		}
+	}
+	if repo.LFS {
+		stage("lfs")
+		if err := m.gitService.PullLFS(ctx, repo); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// 拉取仓库并上传，返回发布的提交
+func (m *SyncManager) sync(task *syncTask) (string, error) {
+	minioPath := task.repo.MinioPath
+	result, err := m.checkout(task.ctx, task.repo, true)
+	if err != nil {
+		log.Printf("同步仓库失败 %s: %v", task.repo.URL, err)
+		return "", err
+	}
+
+	// 回滚后在出现新的提交前不再自动发布回滚前的提交，通过 API 手动同步可以强制发布
+	status := m.minioService.GetSyncStatus(minioPath)
+	if status.RolledBackFrom == result.Commit && !manualTrigger(task.triggeredBy) {
+		log.Printf("仓库已回滚，跳过提交 %s 直到有新的提交: %s", shortCommit(result.Commit), minioPath)
+		m.minioService.startSync(minioPath)
+		return status.Commit, m.minioService.finishSync(minioPath)
+	}
+
+	if err := m.publish(task, result); err != nil {
+		log.Printf("上传到Minio失败 %s: %v", minioPath, err)
+		return "", err
+	}
+
+	m.minioService.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.RolledBackFrom = ""
+	})
+	if err := m.minioService.recordVersion(task.ctx, minioPath, result.Commit, task.triggeredBy); err != nil {
+		log.Printf("记录版本失败 %s: %v", minioPath, err)
+	}
+	return result.Commit, nil
+}
+
+// 上传仓库内容并记录使用的过滤规则
+func (m *SyncManager) publish(task *syncTask, result *SyncResult) error {
+	repo := task.repo
+	var refilter bool
+	_, filter, err := m.minioService.publishRoot(repo.LocalPath, repo.MinioPath)
+	switch {
+	case err == nil:
+		// 过滤规则变化后已发布的内容可能包含被排除或缺少新包含的文件，需要全量同步
+		if refilter = m.minioService.GetSyncStatus(repo.MinioPath).Filter != filter.digest; refilter {
+			log.Printf("发布规则已变化，全量同步: %s", repo.MinioPath)
+		}
+	case repo.Build != nil:
+		// 构建输出目录尚不存在，需要构建后全量同步
+		refilter = true
+	default:
+		return err
+	}
+	if err := m.upload(task, result, refilter); err != nil {
+		return err
+	}
+	if _, filter, err = m.minioService.publishRoot(repo.LocalPath, repo.MinioPath); err != nil {
+		return err
+	}
+	m.minioService.updateSyncStatus(repo.MinioPath, func(status *SyncStatus) {
+		status.Filter = filter.digest
+	})
+	return nil
+}
+
+// 以上次成功发布的提交为基准按 git diff 增量上传，
+// 基准未知（首次同步、重启后）、历史不可用、发布规则变化或通过 API 手动触发时遍历整个目录。
+// 启用原子发布时上传到新的 release 目录后再切换
+func (m *SyncManager) upload(task *syncTask, result *SyncResult, full bool) error {
+	repo := task.repo
+	base := m.minioService.publishedCommit(repo.MinioPath)
+	// 关闭原子发布后需要完整上传一次才能停用 release 目录
+	active, err := m.minioService.activeRelease(repo.MinioPath)
+	if err != nil {
+		return err
+	}
+	retire := !repo.AtomicPublish && active != ""
+
+	if base != "" && !manualTrigger(task.triggeredBy) && !retire && !full {
+		if base == result.Commit {
+			log.Printf("仓库没有新的提交，跳过上传: %s (%s)", repo.MinioPath, shortCommit(result.Commit))
+			m.minioService.startSync(repo.MinioPath)
+			return m.minioService.finishSync(repo.MinioPath)
+		}
+
+		changes, err := m.changedFiles(task.ctx, repo, base, result.Commit)
+		if err == nil {
+			log.Printf("增量同步 %s: %s -> %s", repo.MinioPath, shortCommit(base), shortCommit(result.Commit))
+			if repo.AtomicPublish {
+				if changes == nil {
+					changes = []FileChange{}
+				}
+				return m.minioService.PublishRelease(task.ctx, repo.LocalPath, repo.MinioPath, changes)
+			}
+			return m.minioService.UploadChanges(task.ctx, repo.LocalPath, repo.MinioPath, changes)
+		}
+		log.Printf("无法获取变更列表，回退到全量同步 %s: %v", repo.MinioPath, err)
+	}
+
+	if repo.Build != nil {
+		if err := m.build(task.ctx, repo, result.Commit, true); err != nil {
+			return err
+		}
+	}
+	if repo.AtomicPublish {
+		return m.minioService.PublishRelease(task.ctx, repo.LocalPath, repo.MinioPath, nil)
+	}
+	if err := m.minioService.UploadDirectory(task.ctx, repo.LocalPath, repo.MinioPath); err != nil || !retire {
+		return err
+	}
+	return m.minioService.retireReleases(task.ctx, repo.MinioPath)
+}
+
+// 获取增量同步的变更列表，无法增量同步时返回原因
+func (m *SyncManager) changedFiles(ctx context.Context, repo *config.Repository, base, commit string) ([]FileChange, error) {
+	switch {
+	case isSourceRepo(repo):
+		return nil, fmt.Errorf("%s 来源没有变更记录", repo.Source)
+	case repo.Build != nil:
+		// 构建输出与源文件的变更没有对应关系
+		return nil, fmt.Errorf("仓库配置了构建步骤")
+	}
+	changes, err := m.gitService.ChangedFiles(ctx, repo, base, commit)
+	if err != nil {
+		return nil, err
+	}
+	// 子模块的变更只有提交指针，无法得到其中的文件列表
+	if repo.Submodules && m.gitService.hasSubmoduleChange(repo, changes) {
+		return nil, fmt.Errorf("子模块有变更")
+	}
+	return changes, nil
+}
+
+func shortCommit(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
+
+// StartScheduler 为每个启用同步的仓库启动独立的定时器
+// initialSync 为 true 时启动后立即同步一次，否则等待第一个计划时间
+func (m *SyncManager) StartScheduler(initialSync bool) {
+	for i := range m.config.Git.Repositories {
+		repo := &m.config.Git.Repositories[i]
+		if repo.DisabledSync {
+			log.Printf("仓库同步已禁用，跳过: %s", repo.URL)
+			continue
+		}
+		go m.schedule(repo, initialSync)
+	}
+}
+
+func (m *SyncManager) schedule(repo *config.Repository, initialSync bool) {
+	// 解析 cron 表达式，无效时回退到检查间隔
+	var cron *cronSchedule
+	if repo.CheckSchedule != "" {
+		c, err := parseCron(repo.CheckSchedule)
+		if err != nil {
+			log.Printf("解析仓库 %s 的同步计划失败: %v, 使用检查间隔", repo.URL, err)
+		} else {
+			cron = c
+		}
+	}
+
+	// 确定首次同步时间：有持久化状态时接着上次的计划，已错过则立即同步
+	now := time.Now()
+	next := m.nextRun(repo, cron, now)
+	if initialSync {
+		last := m.minioService.lastSyncTime(repo.MinioPath)
+		if !last.IsZero() {
+			next = m.nextRun(repo, cron, last)
+		}
+		if last.IsZero() || !next.After(now) {
+			m.Enqueue(repo, TriggerStartup)
+			next = m.nextRun(repo, cron, now)
+		} else {
+			log.Printf("仓库 %s 未到同步时间，下次同步: %s", repo.URL, next.Format(time.DateTime))
+		}
+	}
+
+	for {
+		if next.IsZero() {
+			log.Printf("仓库 %s 的同步计划没有后续执行时间，停止定时同步", repo.URL)
+			return
+		}
+		m.minioService.updateSyncStatus(repo.MinioPath, func(status *SyncStatus) {
+			status.NextSync = next
+		})
+
+		time.Sleep(time.Until(next))
+		if m.Enqueue(repo, TriggerSchedule) {
+			log.Printf("已添加定时同步任务: %s", repo.URL)
+		} else {
+			log.Printf("仓库正在同步，跳过本次定时同步: %s", repo.URL)
+		}
+		next = m.nextRun(repo, cron, time.Now())
+	}
+}
+
+// 计算下一次同步时间（含随机延迟）
+func (m *SyncManager) nextRun(repo *config.Repository, cron *cronSchedule, from time.Time) time.Time {
+	if cron != nil {
+		next := cron.Next(from)
+		if next.IsZero() {
+			return next
+		}
+		// 以相邻两次触发的间隔估算随机延迟上限
+		interval := time.Hour
+		if after := cron.Next(next); !after.IsZero() {
+			interval = after.Sub(next)
+		}
+		return next.Add(m.jitter(interval))
+	}
+
+	interval := m.gitService.GetCheckInterval(repo)
+	return from.Add(interval + m.jitter(interval))
+}
+
+// 随机延迟，避免多个仓库同时同步
+func (m *SyncManager) jitter(interval time.Duration) time.Duration {
+	max := interval / 10
+	if max > 5*time.Minute {
+		max = 5 * time.Minute
+	}
+	if m.config.Git.Jitter != "" {
+		d, err := parseDurationCustom(m.config.Git.Jitter)
+		if err != nil {
+			log.Printf("解析同步随机延迟失败: %v", err)
+		} else {
+			max = d
+		}
+	}
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
@@ -0,0 +1,471 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"pysio.online/Files-API/internal/config"
+)
+
+// VersionsPrefix 版本记录在默认存储中的前缀：
+// .versions/{minioPath}/manifests/{id}.json 为版本清单，
+// .versions/{minioPath}/blobs/{sha1} 为被覆盖或删除的旧文件内容
+const VersionsPrefix = ".versions/"
+
+// 默认保留的版本数
+const defaultKeepVersions = 10
+
+// Version 一次成功同步发布的版本
+type Version struct {
+	ID          string            `json:"id"`
+	Commit      string            `json:"commit"`
+	Time        time.Time         `json:"time"`
+	TriggeredBy string            `json:"triggeredBy,omitempty"`
+	Release     string            `json:"release,omitempty"` // 原子发布时对应的 release 目录
+	Files       int               `json:"files"`
+	Objects     map[string]string `json:"objects,omitempty"` // 相对 minioPath 的路径 -> SHA1
+}
+
+func versionDir(minioPath string) string {
+	return VersionsPrefix + minioPath + "/"
+}
+
+func manifestKey(minioPath, id string) string {
+	return versionDir(minioPath) + "manifests/" + id + ".json"
+}
+
+func blobKey(minioPath, sha1 string) string {
+	return versionDir(minioPath) + "blobs/" + sha1
+}
+
+func (s *MinioService) repository(minioPath string) *config.Repository {
+	for i := range s.config.Git.Repositories {
+		if s.config.Git.Repositories[i].MinioPath == minioPath {
+			return &s.config.Git.Repositories[i]
+		}
+	}
+	return nil
+}
+
+// 仓库保留的版本数，0 表示不记录版本
+func (s *MinioService) keepVersions(minioPath string) int {
+	repo := s.repository(minioPath)
+	switch {
+	case repo == nil:
+		return 0
+	case repo.KeepVersions == 0:
+		return defaultKeepVersions
+	case repo.KeepVersions < 0:
+		return 0
+	}
+	return repo.KeepVersions
+}
+
+// 开始记录本次同步发布的对象，base 为 nil 时表示无法得到完整清单
+func (s *MinioService) beginManifest(minioPath string, base map[string]string) {
+	s.manifestMutex.Lock()
+	defer s.manifestMutex.Unlock()
+
+	if base == nil {
+		delete(s.manifests, minioPath)
+		return
+	}
+	manifest := make(map[string]string, len(base))
+	for k, v := range base {
+		manifest[k] = v
+	}
+	s.manifests[minioPath] = manifest
+}
+
+// 记录对象的 SHA1，sha1 为空时表示对象已删除
+func (s *MinioService) trackObject(minioPath, objectName, sha1 string) {
+	s.manifestMutex.Lock()
+	defer s.manifestMutex.Unlock()
+
+	manifest, ok := s.manifests[minioPath]
+	if !ok {
+		return
+	}
+	rel := strings.TrimPrefix(objectName, minioPath+"/")
+	if sha1 == "" {
+		delete(manifest, rel)
+	} else {
+		manifest[rel] = sha1
+	}
+}
+
+// 当前发布版本的文件清单，版本与已发布的提交不一致时返回 nil
+func (s *MinioService) activeManifest(ctx context.Context, minioPath string) map[string]string {
+	status := s.GetSyncStatus(minioPath)
+	if status.Version == "" || s.keepVersions(minioPath) == 0 {
+		return nil
+	}
+	v, err := s.loadVersion(ctx, minioPath, status.Version)
+	if err != nil || v.Commit != status.Commit {
+		return nil
+	}
+	return v.Objects
+}
+
+// 复制一份正在记录的文件清单
+func (s *MinioService) manifestSnapshot(minioPath string) map[string]string {
+	s.manifestMutex.Lock()
+	defer s.manifestMutex.Unlock()
+
+	snapshot := make(map[string]string, len(s.manifests[minioPath]))
+	for k, v := range s.manifests[minioPath] {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+func (s *MinioService) takeManifest(minioPath string) map[string]string {
+	s.manifestMutex.Lock()
+	defer s.manifestMutex.Unlock()
+
+	manifest := s.manifests[minioPath]
+	delete(s.manifests, minioPath)
+	return manifest
+}
+
+// 覆盖或删除对象前保存旧内容，已保存过相同内容时跳过
+func (s *MinioService) archiveObject(ctx context.Context, minioPath, objectName string) {
+	if s.keepVersions(minioPath) == 0 {
+		return
+	}
+	info, err := s.storage.Stat(ctx, "", objectName)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("保存旧版本失败 %s: %v", objectName, err)
+		}
+		return
+	}
+	sha1 := info.Metadata["Sha1"]
+	if sha1 == "" {
+		return
+	}
+	blob := blobKey(minioPath, sha1)
+	if _, err := s.storage.Stat(ctx, "", blob); err == nil {
+		return
+	}
+	if err := s.storage.Copy(ctx, "", objectName, blob); err != nil {
+		log.Printf("保存旧版本失败 %s: %v", objectName, err)
+	}
+}
+
+// ListVersions 列出仓库的版本记录，按时间从新到旧排序，不包含文件清单
+func (s *MinioService) ListVersions(ctx context.Context, minioPath string) ([]Version, error) {
+	versions, err := s.loadVersions(ctx, minioPath)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		versions[i].Objects = nil
+	}
+	return versions, nil
+}
+
+func (s *MinioService) loadVersions(ctx context.Context, minioPath string) ([]Version, error) {
+	objects, err := s.storage.List(ctx, "", versionDir(minioPath)+"manifests/")
+	if err != nil {
+		return nil, fmt.Errorf("获取版本列表失败: %v", err)
+	}
+
+	var versions []Version
+	for _, obj := range objects {
+		id := strings.TrimSuffix(path.Base(obj.Key), ".json")
+		v, err := s.loadVersion(ctx, minioPath, id)
+		if err != nil {
+			log.Printf("读取版本清单失败 %s: %v", obj.Key, err)
+			continue
+		}
+		versions = append(versions, *v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if !versions[i].Time.Equal(versions[j].Time) {
+			return versions[i].Time.After(versions[j].Time)
+		}
+		return versions[i].ID > versions[j].ID
+	})
+	return versions, nil
+}
+
+func (s *MinioService) loadVersion(ctx context.Context, minioPath, id string) (*Version, error) {
+	obj, err := s.storage.Get(ctx, "", manifestKey(minioPath, id))
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	var v Version
+	if err := json.NewDecoder(obj).Decode(&v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// FindVersion 按版本 ID 或提交（至少 7 位前缀）查找版本，同一提交有多个版本时返回最新的
+func (s *MinioService) FindVersion(ctx context.Context, minioPath, ref string) (*Version, error) {
+	versions, err := s.loadVersions(ctx, minioPath)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].ID == ref {
+			return &versions[i], nil
+		}
+	}
+	if len(ref) >= 7 {
+		for i := range versions {
+			if strings.HasPrefix(versions[i].Commit, ref) {
+				return &versions[i], nil
+			}
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// 同步成功后记录版本，内容与当前版本相同时不重复记录
+func (s *MinioService) recordVersion(ctx context.Context, minioPath, commit, triggeredBy string) error {
+	manifest := s.takeManifest(minioPath)
+	keep := s.keepVersions(minioPath)
+	if keep == 0 {
+		return nil
+	}
+
+	versions, err := s.loadVersions(ctx, minioPath)
+	if err != nil {
+		return err
+	}
+
+	// 当前发布的版本，回滚后不一定是最新的版本
+	status := s.GetSyncStatus(minioPath)
+	var current *Version
+	for i := range versions {
+		if versions[i].ID == status.Version {
+			current = &versions[i]
+			break
+		}
+	}
+	if current == nil && len(versions) > 0 {
+		current = &versions[0]
+	}
+	if current != nil && current.Commit == commit && status.Uploaded+status.Deleted == 0 {
+		s.setActiveVersion(minioPath, current.ID)
+		return nil
+	}
+
+	// 增量同步前没有版本记录时，从存储中读取当前发布的文件
+	if manifest == nil {
+		if manifest, err = s.currentManifest(ctx, minioPath); err != nil {
+			return err
+		}
+	}
+	if current != nil && current.Commit == commit && sameManifest(current.Objects, manifest) {
+		s.setActiveVersion(minioPath, current.ID)
+		return nil
+	}
+
+	release, err := s.activeRelease(minioPath)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	v := Version{
+		ID:          now.Format("20060102T150405Z") + "-" + shortCommit(commit),
+		Commit:      commit,
+		Time:        now,
+		TriggeredBy: triggeredBy,
+		Release:     release,
+		Files:       len(manifest),
+		Objects:     manifest,
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := s.storage.Put(ctx, "", manifestKey(minioPath, v.ID), bytes.NewReader(data), int64(len(data)), PutOptions{ContentType: "application/json"}); err != nil {
+		return fmt.Errorf("保存版本清单失败: %v", err)
+	}
+	log.Printf("已记录版本 %s: %s", minioPath, v.ID)
+	s.setActiveVersion(minioPath, v.ID)
+
+	return s.pruneVersions(ctx, minioPath, append([]Version{v}, versions...), keep)
+}
+
+func (s *MinioService) setActiveVersion(minioPath, id string) {
+	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.Version = id
+	})
+}
+
+// 读取当前已发布文件的 SHA1
+func (s *MinioService) currentManifest(ctx context.Context, minioPath string) (map[string]string, error) {
+	live, err := s.livePrefix(minioPath)
+	if err != nil {
+		return nil, err
+	}
+	prefix := live + "/"
+	objects, err := s.storage.List(ctx, "", prefix)
+	if err != nil {
+		return nil, fmt.Errorf("获取文件列表失败: %v", err)
+	}
+	manifest := make(map[string]string, len(objects))
+	for _, obj := range objects {
+		sha1 := obj.Metadata["Sha1"]
+		if sha1 == "" {
+			info, err := s.storage.Stat(ctx, "", obj.Key)
+			if err != nil {
+				return nil, err
+			}
+			sha1 = info.Metadata["Sha1"]
+		}
+		manifest[strings.TrimPrefix(obj.Key, prefix)] = sha1
+	}
+	return manifest, nil
+}
+
+func sameManifest(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// 删除超出保留数量的版本，并清理不再被任何版本引用的旧文件内容
+func (s *MinioService) pruneVersions(ctx context.Context, minioPath string, versions []Version, keep int) error {
+	if len(versions) <= keep {
+		return nil
+	}
+	// 当前发布的版本始终保留
+	active := s.GetSyncStatus(minioPath).Version
+	referenced := make(map[string]bool)
+	for i, v := range versions {
+		if i < keep || v.ID == active {
+			for _, sha1 := range v.Objects {
+				referenced[sha1] = true
+			}
+			continue
+		}
+		if err := s.storage.Remove(ctx, "", manifestKey(minioPath, v.ID)); err != nil {
+			return fmt.Errorf("删除版本清单失败 %s: %v", v.ID, err)
+		}
+		log.Printf("已清理过期版本 %s: %s", minioPath, v.ID)
+	}
+
+	blobs, err := s.storage.List(ctx, "", versionDir(minioPath)+"blobs/")
+	if err != nil {
+		return fmt.Errorf("获取旧文件列表失败: %v", err)
+	}
+	for _, blob := range blobs {
+		if !referenced[path.Base(blob.Key)] {
+			if err := s.storage.Remove(ctx, "", blob.Key); err != nil {
+				log.Printf("删除旧文件失败 %s: %v", blob.Key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// 检查恢复版本所需的文件内容：live 下内容相同的文件直接使用，其余文件的旧版本内容必须存在
+func (s *MinioService) checkVersionBlobs(ctx context.Context, minioPath, live string, v *Version) error {
+	var missing []string
+	for rel, sha1 := range v.Objects {
+		if info, err := s.storage.Stat(ctx, "", live+"/"+rel); err == nil && info.Metadata["Sha1"] == sha1 {
+			continue
+		}
+		if _, err := s.storage.Stat(ctx, "", blobKey(minioPath, sha1)); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("检查版本文件失败 %s: %v", rel, err)
+			}
+			missing = append(missing, rel)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		n := len(missing)
+		if n > 5 {
+			missing = append(missing[:5], "...")
+		}
+		return fmt.Errorf("版本 %s 中 %d 个文件的内容已被清理，无法回滚: %s", v.ID, n, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Rollback 将仓库发布的内容恢复到指定版本
+func (s *MinioService) Rollback(ctx context.Context, minioPath string, v *Version) (err error) {
+	s.startSync(minioPath)
+	defer s.recoverSync(minioPath, &err)
+
+	log.Printf("开始回滚 %s 到版本 %s (%s)", minioPath, v.ID, shortCommit(v.Commit))
+	atomic, err := s.atomicPublish(minioPath)
+	if err != nil {
+		return err
+	}
+	if atomic {
+		return s.rollbackRelease(ctx, minioPath, v)
+	}
+	// 只处理本仓库的文件，嵌套仓库发布的内容保持不变
+	live, err := s.repoObjects(ctx, minioPath, minioPath)
+	if err != nil {
+		return err
+	}
+
+	// 修改任何文件前确认版本的内容都还在，避免回滚到一半留下两个版本混合的内容
+	if err := s.checkVersionBlobs(ctx, minioPath, minioPath, v); err != nil {
+		return err
+	}
+
+	var jobs []fileJob
+	for rel := range v.Objects {
+		jobs = append(jobs, fileJob{objectName: path.Join(minioPath, rel)})
+	}
+	var removals []string
+	for _, rel := range live {
+		if _, ok := v.Objects[rel]; !ok {
+			removals = append(removals, minioPath+"/"+rel)
+		}
+	}
+	s.updateSyncStatus(minioPath, func(status *SyncStatus) {
+		status.TotalFiles = len(jobs) + len(removals)
+	})
+
+	s.runJobs(ctx, jobs, func(job fileJob) {
+		sha1 := v.Objects[strings.TrimPrefix(job.objectName, minioPath+"/")]
+		if info, err := s.storage.Stat(ctx, "", job.objectName); err == nil && info.Metadata["Sha1"] == sha1 {
+			s.recordFile(minioPath, job.objectName, fileSkipped, nil)
+			return
+		}
+		s.archiveObject(ctx, minioPath, job.objectName)
+		err := s.storage.Copy(ctx, "", blobKey(minioPath, sha1), job.objectName)
+		if errors.Is(err, os.ErrNotExist) {
+			err = fmt.Errorf("版本中的文件内容已被清理")
+		}
+		if err != nil {
+			log.Printf("恢复文件失败 %s: %v", job.objectName, err)
+		}
+		s.recordUpload(ctx, minioPath, job.objectName, sha1, err)
+	})
+
+	if err := ctx.Err(); err != nil {
+		return s.finishCancelled(ctx, minioPath, err)
+	}
+	if err := s.removeObjects(ctx, minioPath, removals); err != nil {
+		return s.finishCancelled(ctx, minioPath, err)
+	}
+	return s.finishSync(minioPath)
+}
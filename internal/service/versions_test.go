@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRollbackKeepsNestedRepository(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryService(t, "docs", "docs/api")
+	putObject(t, s, "docs/index.html", "new index")
+	putObject(t, s, "docs/added.html", "added after the version")
+	putObject(t, s, "docs/api/reference.html", "published by docs/api")
+	putObject(t, s, blobKey("docs", "0123abcd"), "old index")
+
+	v := &Version{ID: "v1", Commit: "abc", Objects: map[string]string{"index.html": "0123abcd"}}
+	if err := s.Rollback(ctx, "docs", v); err != nil {
+		t.Fatalf("回滚失败: %v", err)
+	}
+
+	if _, err := s.storage.Stat(ctx, "", "docs/api/reference.html"); err != nil {
+		t.Errorf("嵌套仓库 docs/api 的文件不应被删除: %v", err)
+	}
+	if _, err := s.storage.Stat(ctx, "", "docs/added.html"); err == nil {
+		t.Errorf("版本中不存在的 docs/added.html 应被删除")
+	}
+	obj, err := s.storage.Get(ctx, "", "docs/index.html")
+	if err != nil {
+		t.Fatalf("docs/index.html 应恢复为版本中的内容: %v", err)
+	}
+	defer obj.Close()
+	if data, _ := io.ReadAll(obj); string(data) != "old index" {
+		t.Errorf("docs/index.html = %q，期望 %q", data, "old index")
+	}
+}
+
+func TestRollbackAbortsWhenBlobsAreMissing(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryService(t, "docs")
+	putObject(t, s, "docs/index.html", "new index")
+	putObject(t, s, "docs/added.html", "added after the version")
+	putObject(t, s, blobKey("docs", "0123abcd"), "old index")
+
+	// guide.html 的内容已被清理
+	v := &Version{ID: "v1", Commit: "abc", Objects: map[string]string{"index.html": "0123abcd", "guide.html": "4567ef01"}}
+	err := s.Rollback(ctx, "docs", v)
+	if err == nil || !strings.Contains(err.Error(), "guide.html") {
+		t.Fatalf("Rollback = %v，期望因缺少 guide.html 的内容而中止", err)
+	}
+
+	// 中止前没有修改任何文件
+	obj, err := s.storage.Get(ctx, "", "docs/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	if data, _ := io.ReadAll(obj); string(data) != "new index" {
+		t.Errorf("docs/index.html = %q，不应被修改", data)
+	}
+	if _, err := s.storage.Stat(ctx, "", "docs/added.html"); err != nil {
+		t.Errorf("docs/added.html 不应被删除: %v", err)
+	}
+}
@@ -1,12 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"time"
+	"strings"
 
 	"pysio.online/Files-API/internal/config"
 	"pysio.online/Files-API/internal/handler"
@@ -15,38 +16,6 @@ import (
 	"pysio.online/Files-API/internal/service"
 )
 
-// 同步任务
-type syncTask struct {
-	repo         *config.Repository
-	gitService   *service.GitService
-	minioService *service.MinioService
-}
-
-func syncWorker(taskChan <-chan syncTask) {
-	for task := range taskChan {
-		// 获取仓库的检查间隔
-		interval := task.gitService.GetCheckInterval(task.repo)
-
-		if err := task.gitService.SyncRepository(task.repo); err != nil {
-			log.Printf("同步仓库失败 %s: %v", task.repo.URL, err)
-			continue
-		}
-
-		// 传递检查间隔到 UploadDirectory
-		if err := task.minioService.UploadDirectory(task.repo.LocalPath, task.repo.MinioPath, interval); err != nil {
-			log.Printf("上传到Minio失败 %s: %v", task.repo.MinioPath, err)
-		}
-	}
-}
-
-func startSyncWorkers(numWorkers int) chan<- syncTask {
-	taskChan := make(chan syncTask)
-	for i := 0; i < numWorkers; i++ {
-		go syncWorker(taskChan)
-	}
-	return taskChan
-}
-
 func main() {
 	// 解析命令行参数
 	flags := middleware.ParseFlags()
@@ -110,25 +79,33 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// 检查Minio连通性
+	// 检查Minio连通性，使用本地或内存存储时跳过
 	if err := minioService.CheckConnection(); err != nil {
 		log.Fatalf("Minio服务器检查失败: %v", err)
 	}
-	log.Printf("Minio服务器连接正常")
+	if cfg.Storage.Driver == "" || cfg.Storage.Driver == service.DriverMinio {
+		log.Printf("Minio服务器连接正常")
+	} else {
+		log.Printf("使用 %s 存储后端", cfg.Storage.Driver)
+	}
 
 	gitService := service.NewGitService(cfg)
 
+	// 恢复持久化的同步状态
+	if err := minioService.LoadSyncState(); err != nil {
+		log.Printf("恢复同步状态失败: %v", err)
+	}
+
+	syncManager := service.NewSyncManager(cfg, gitService, minioService)
+
 	// 处理单次同步命令
 	if flags.Sync {
 		log.Printf("执行单次同步检查...")
-		for _, repo := range cfg.Git.Repositories {
+		for i := range cfg.Git.Repositories {
+			repo := &cfg.Git.Repositories[i]
 			log.Printf("同步仓库: %s", repo.URL)
-			if err := gitService.SyncRepository(&repo); err != nil {
-				log.Printf("同步仓库失败 %s: %v", repo.URL, err)
-				continue
-			}
-			if err := minioService.UploadDirectory(repo.LocalPath, repo.MinioPath, 0); err != nil {
-				log.Printf("上传到Minio失败 %s: %v", repo.MinioPath, err)
+			if err := syncOnce(syncManager, repo, flags); err != nil {
+				log.Printf("同步仓库失败 %s: %v", repo.MinioPath, err)
 			}
 		}
 		log.Printf("单次同步检查完成")
@@ -138,74 +115,32 @@ func main() {
 	// 新增：处理 rsync 命令
 	if flags.RSync != "" {
 		log.Printf("执行指定仓库同步: %s", flags.RSync)
-		found := false
-		for _, repo := range cfg.Git.Repositories {
-			if repo.MinioPath == flags.RSync {
-				found = true
-				log.Printf("同步仓库: %s", repo.URL)
-				if err := gitService.SyncRepository(&repo); err != nil {
-					log.Printf("同步仓库失败 %s: %v", repo.URL, err)
-					os.Exit(1)
-				}
-				if err := minioService.UploadDirectory(repo.LocalPath, repo.MinioPath, 0); err != nil {
-					log.Printf("上传到Minio失败 %s: %v", repo.MinioPath, err)
-					os.Exit(1)
-				}
-				log.Printf("指定仓库同步完成: %s", repo.MinioPath)
-				os.Exit(0)
-			}
-		}
-		if !found {
+		repo := syncManager.FindRepository(flags.RSync)
+		if repo == nil {
 			log.Printf("未找到指定的仓库: %s", flags.RSync)
 			os.Exit(1)
 		}
+		log.Printf("同步仓库: %s", repo.URL)
+		if err := syncOnce(syncManager, repo, flags); err != nil {
+			log.Printf("同步仓库失败 %s: %v", repo.MinioPath, err)
+			os.Exit(1)
+		}
+		log.Printf("指定仓库同步完成: %s", repo.MinioPath)
+		os.Exit(0)
 	}
 
 	// 仅在非 API-only 模式时启动自动同步任务
 	if !cfg.Server.APIOnly {
 		// 启动同步工作池
-		taskChan := startSyncWorkers(2) // 使用2个工作线程
+		syncManager.Start(2) // 使用2个工作线程
 
+		// 启动按仓库独立调度的定时同步
 		if !flags.Skip {
 			log.Printf("开始初始同步...")
-			for _, repo := range cfg.Git.Repositories {
-				if repo.DisabledSync {
-					log.Printf("仓库同步已禁用，跳过: %s", repo.URL)
-					continue
-				}
-				taskChan <- syncTask{
-					repo:         &repo,
-					gitService:   gitService,
-					minioService: minioService,
-				}
-			}
 		} else {
 			log.Printf("已跳过初始同步，等待下一个检查周期...")
-			for _, repo := range cfg.Git.Repositories {
-				minioService.InitLastSync(repo.MinioPath)
-			}
 		}
-
-		// 定时同步任务
-		go func() {
-			ticker := time.NewTicker(10 * time.Minute)
-			for range ticker.C {
-				log.Printf("开始定时同步...")
-				for _, repo := range cfg.Git.Repositories {
-					if repo.DisabledSync {
-						continue
-					}
-					log.Printf("正在等待同步仓库: %s", repo.URL)
-					taskChan <- syncTask{
-						repo:         &repo,
-						gitService:   gitService,
-						minioService: minioService,
-					}
-					log.Printf("已添加同步任务: %s", repo.URL)
-				}
-				log.Printf("已添加所有同步任务到队列")
-			}
-		}()
+		syncManager.StartScheduler(!flags.Skip)
 	} else {
 		log.Printf("API-only 模式，跳过文件同步任务")
 	}
@@ -218,7 +153,7 @@ func main() {
 	}
 
 	// 初始化外部URL中间件
-	externalURLMiddleware := middleware.NewExternalURLMiddleware(minioService, cfg)
+	externalURLMiddleware := middleware.NewExternalURLMiddleware(minioService.Storage(), cfg)
 	// 添加：执行初始化同步
 	externalURLMiddleware.Init()
 
@@ -227,17 +162,30 @@ func main() {
 
 	// 2. 处理 API 路由
 	if cfg.Server.EnableAPI {
-		apiHandler := handler.NewAPIHandler(minioService, cfg)
-		http.Handle("/api/files/", corsMiddleware.Middleware(cacheMiddleware.Middleware(apiHandler)))
+		apiHandler := handler.NewAPIHandler(minioService.Storage(), syncManager, cfg)
+		// 创建 API 认证中间件，需位于缓存中间件之前，列表请求按挂载表确定存储桶
+		authMiddleware := middleware.NewAuthMiddleware(&cfg.Auth, &cfg.Logs, apiHandler.BucketOf)
+		http.Handle("/api/files/", corsMiddleware.Middleware(authMiddleware.Middleware(cacheMiddleware.Middleware(apiHandler))))
 		log.Printf("API 服务已启用: /api/files/")
+		if cfg.Auth.Enabled {
+			log.Printf("API 认证已启用: %d 个密钥", len(cfg.Auth.Keys))
+		}
 	}
 
 	// 3. 处理文件服务路由
 	if !cfg.Server.APIOnly {
-		docsHandler := handler.NewDocsHandler(minioService, cfg)
+		docsHandler := handler.NewDocsHandler(minioService.Storage(), cfg)
+		// 站点中间件位于最外层，CORS 和缓存中间件使用站点的配置
+		siteMiddleware, err := middleware.NewSiteMiddleware(cfg.Sites, cfg.Server.TrustedProxies)
+		if err != nil {
+			log.Fatalf("初始化站点中间件失败: %v", err)
+		}
 		// 添加 CORS 中间件到处理链中
-		http.Handle("/", corsMiddleware.Middleware(externalURLMiddleware.Middleware(cacheMiddleware.Middleware(docsHandler))))
+		http.Handle("/", siteMiddleware.Middleware(corsMiddleware.Middleware(externalURLMiddleware.Middleware(cacheMiddleware.Middleware(docsHandler)))))
 		log.Printf("文件服务已启用: /")
+		for _, site := range cfg.Sites {
+			log.Printf("已注册站点: %s", strings.Join(site.Hosts, ", "))
+		}
 
 		// 记录外部URL配置
 		if len(cfg.ExternalURLs) > 0 {
@@ -259,3 +207,40 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// 命令行单次同步，--dry-run 时只输出同步计划，--restamp 时只重新设置 Content-Type
+func syncOnce(syncManager *service.SyncManager, repo *config.Repository, flags *middleware.CliFlags) error {
+	if flags.Restamp {
+		result, err := syncManager.Restamp(context.Background(), repo, flags.DryRun)
+		if err != nil {
+			return err
+		}
+		for _, change := range result.Changes {
+			log.Printf("  %s: %s -> %s", change.Key, change.From, change.To)
+		}
+		log.Printf("Content-Type 检查 %s: 共 %d 个，需要修改 %d 个，已修改 %d 个，失败 %d 个", repo.MinioPath, result.Checked, len(result.Changes), result.Updated, result.Failed)
+		if result.Failed > 0 {
+			return fmt.Errorf("%d 个文件设置 Content-Type 失败", result.Failed)
+		}
+		return nil
+	}
+	if !flags.DryRun {
+		return syncManager.RunNow(context.Background(), repo, flags.ConfirmDeletions)
+	}
+
+	plan, err := syncManager.DryRun(context.Background(), repo)
+	if err != nil {
+		return err
+	}
+	log.Printf("同步计划 %s (%s): 上传 %d 个，删除 %d 个，未变更 %d 个", plan.MinioPath, plan.Commit, len(plan.Uploads), len(plan.Deletions), plan.Unchanged)
+	for _, objectName := range plan.Uploads {
+		log.Printf("  + %s", objectName)
+	}
+	for _, objectName := range plan.Deletions {
+		log.Printf("  - %s", objectName)
+	}
+	if plan.Blocked != "" {
+		log.Printf("删除数量超过限制 %s，同步时需要 --confirm-deletions 确认", plan.Blocked)
+	}
+	return nil
+}